@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
+)
+
+// ExportData sends the logged in user a ZIP of everything we keep about
+// them: their account, the records of their images, and the images.
+func (app *application) ExportData(w http.ResponseWriter, r *http.Request) {
+	sessionUser, _ := reqctx.User(r.Context())
+
+	// everything is read before the first byte of the ZIP is sent, while an
+	// error can still be shown as a page
+	user, err := app.DB.GetUser(sessionUser.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	images, err := app.DB.UserImages(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if images == nil {
+		images = []*data.UserImage{}
+	}
+
+	userJSON, err := json.MarshalIndent(user, "", "  ")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	imagesJSON, err := json.MarshalIndent(images, "", "  ")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditDataExported, user.ID, nil)
+
+	name := fmt.Sprintf("webapp-export-%s.zip", time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	zw := zip.NewWriter(w)
+	if err := writeZipFile(zw, "user.json", userJSON); err != nil {
+		log.Println("error exporting data:", err)
+		return
+	}
+	if err := writeZipFile(zw, "images.json", imagesJSON); err != nil {
+		log.Println("error exporting data:", err)
+		return
+	}
+	for _, i := range images {
+		content, err := os.ReadFile(filepath.Join(uploadPath, filepath.Base(i.FileName)))
+		if err != nil {
+			// the record is in the export even if the file is gone
+			log.Println("error exporting image:", err)
+			continue
+		}
+		if err := writeZipFile(zw, "images/"+filepath.Base(i.FileName), content); err != nil {
+			log.Println("error exporting data:", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Println("error exporting data:", err)
+	}
+}
+
+// writeZipFile adds a file called name to a ZIP.
+func writeZipFile(zw *zip.Writer, name string, content []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+// DeleteAccount asks the logged in user to confirm, with their password or
+// by logging in with the identity provider again, that they want to delete
+// their account.
+func (app *application) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var td = make(map[string]any)
+	if app.DeleteGrace > 0 {
+		td["graceDays"] = int(app.DeleteGrace.Hours()+23) / 24
+	}
+	if app.OIDC != nil {
+		td["oidc"] = app.OIDCName
+	}
+	td["reauthenticated"] = app.recentlyReauthenticated(r)
+
+	_ = app.render(w, r, "account-delete.page.gohtml", &TemplateData{Data: td})
+}
+
+// PostDeleteAccount deletes the logged in user, and logs them out of all
+// their sessions. With a grace period the account waits in the trash, where
+// an admin can still restore it, and is erased once the period is over;
+// without one it is erased at once.
+func (app *application) PostDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Password string `form:"password"`
+	}
+
+	form := NewForm(r.PostForm)
+	form.Printer = app.printer(r)
+	if err := form.Bind(&input); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sessionUser, _ := reqctx.User(r.Context())
+	user, err := app.DB.GetUser(sessionUser.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// users who signed up with the identity provider don't know their
+	// password, and confirm by logging in with the provider again instead
+	if !app.recentlyReauthenticated(r) {
+		form.Required("password")
+		if input.Password != "" {
+			valid, err := user.PasswordMatches(input.Password)
+			form.Check(err == nil && valid, "password", "This isn't your password")
+		}
+	}
+
+	if !form.Valid() {
+		app.stashForm(r, form)
+		http.Redirect(w, r, "/user/delete", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.deleteUser(r, user.ID, map[string]any{"self": true}); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.endSession(w, r, app.T(r, "Your account has been deleted"))
+}
+
+// deleteUser moves a user to the trash, which logs them out, and audits it.
+// Without a grace period they are erased at once.
+func (app *application) deleteUser(r *http.Request, id int, details map[string]any) error {
+	if err := app.DB.DeleteUser(id); err != nil {
+		return err
+	}
+
+	// audited before the user can be erased, while the event can still
+	// refer to them
+	app.audit(r, data.AuditUserDeleted, id, details)
+
+	if app.DeleteGrace == 0 {
+		_, err := app.purgeDeletedUsers(time.Now())
+		return err
+	}
+	return nil
+}
+
+// purgeDeletedUsers erases the users deleted before olderThan, and removes
+// the image files nobody has any more from uploadPath.
+func (app *application) purgeDeletedUsers(olderThan time.Time) (int, error) {
+	n, files, err := app.DB.PurgeDeletedUsers(olderThan)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, f := range files {
+		err := os.Remove(filepath.Join(uploadPath, filepath.Base(f)))
+		if err != nil && !os.IsNotExist(err) {
+			log.Println("error removing image:", err)
+		}
+	}
+
+	return n, nil
+}
+
+// purgeDeletedAccounts erases, every interval, the users whose grace period
+// is over. It runs until the program exits.
+func (app *application) purgeDeletedAccounts(interval time.Duration) {
+	for {
+		n, err := app.purgeDeletedUsers(time.Now().Add(-app.DeleteGrace))
+		if err != nil {
+			log.Println("error purging deleted users:", err)
+		}
+		if n > 0 {
+			log.Printf("erased %d deleted users", n)
+		}
+
+		time.Sleep(interval)
+	}
+}
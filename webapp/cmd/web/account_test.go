@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+)
+
+// useUploadDir points uploadPath at a new directory with the given files,
+// for the duration of a test.
+func useUploadDir(t *testing.T, files ...string) string {
+	dir := t.TempDir()
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := uploadPath
+	uploadPath = dir
+	t.Cleanup(func() { uploadPath = old })
+
+	return dir
+}
+
+func Test_app_ExportData(t *testing.T) {
+	// shared.png is missing, and is left out rather than failing the export
+	useUploadDir(t, "profile.png")
+
+	req := httptest.NewRequest("GET", "/user/export", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 2})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.ExportData).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, but got %d", rr.Code)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("expected an attachment, but got %q", cd)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("expected a zip: %s", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		_, _ = b.ReadFrom(rc)
+		rc.Close()
+		files[f.Name] = b.Bytes()
+	}
+
+	if len(files) != 3 {
+		t.Errorf("expected user.json, images.json and one image, but got %d files", len(files))
+	}
+
+	var user map[string]any
+	if err := json.Unmarshal(files["user.json"], &user); err != nil {
+		t.Errorf("error decoding user.json: %s", err)
+	}
+	if user["email"] != "2fa@example.com" {
+		t.Errorf("expected the user's email in user.json, but got %v", user["email"])
+	}
+	if _, ok := user["password"]; ok {
+		t.Error("expected no password in user.json")
+	}
+
+	var images []data.UserImage
+	if err := json.Unmarshal(files["images.json"], &images); err != nil || len(images) != 2 {
+		t.Errorf("expected two image records, but got %v, %v", images, err)
+	}
+
+	if string(files["images/profile.png"]) != "profile.png" {
+		t.Error("expected images/profile.png in the export")
+	}
+}
+
+func Test_app_PostDeleteAccount(t *testing.T) {
+	var tests = []struct {
+		name          string
+		password      string
+		grace         time.Duration
+		expectedLoc   string
+		expectedError string
+		expectedFiles []string
+	}{
+		{"no password", "", 0, "/user/delete", "This field cannot be blank", []string{"profile.png", "shared.png"}},
+		{"wrong password", "wrong", 0, "/user/delete", "This isn't your password", []string{"profile.png", "shared.png"}},
+		{"erased at once", "secret", 0, "/", "", []string{"shared.png"}},
+		{"grace period", "secret", 30 * 24 * time.Hour, "/", "", []string{"profile.png", "shared.png"}},
+	}
+
+	for _, e := range tests {
+		dir := useUploadDir(t, "profile.png", "shared.png")
+		testApp := app
+		testApp.DeleteGrace = e.grace
+
+		postedData := url.Values{"password": {e.password}}
+		req := httptest.NewRequest("POST", "/user/delete", strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, testApp)
+		req = logIn(req, testApp, data.User{ID: 2})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.PostDeleteAccount).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status 303, but got %d", e.name, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+
+		if e.expectedError != "" {
+			form := testApp.popForm(req)
+			if msg := form.Errors.Get("password"); msg != e.expectedError {
+				t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+			}
+		} else {
+			if testApp.Session.Exists(req.Context(), "user") {
+				t.Errorf("%s: expected the user to be logged out", e.name)
+			}
+			if flash := testApp.Session.GetString(req.Context(), "flash"); flash != "Your account has been deleted" {
+				t.Errorf("%s: unexpected flash %q", e.name, flash)
+			}
+		}
+
+		// shared.png belongs to another user too, so it is never removed
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if strings.Join(names, ",") != strings.Join(e.expectedFiles, ",") {
+			t.Errorf("%s: expected files %v, but got %v", e.name, e.expectedFiles, names)
+		}
+	}
+}
+
+func Test_app_DeleteAccount(t *testing.T) {
+	var tests = []struct {
+		name     string
+		grace    time.Duration
+		expected string
+	}{
+		{"no grace period", 0, "this can&#39;t be undone"},
+		{"grace period", 30 * 24 * time.Hour, "kept for 30 days"},
+	}
+
+	for _, e := range tests {
+		testApp := app
+		testApp.DeleteGrace = e.grace
+
+		req := httptest.NewRequest("GET", "/user/delete", nil)
+		req = addContextAndSessionToRequest(req, testApp)
+		req = logIn(req, testApp, data.User{ID: 2})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.DeleteAccount).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, but got %d", e.name, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), e.expected) {
+			t.Errorf("%s: expected %q on the page", e.name, e.expected)
+		}
+	}
+}
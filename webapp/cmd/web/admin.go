@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+	"webapp/pkg/reqctx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminUsers lists all users, with their roles.
+func (app *application) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.DB.AllUsers()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	roles, err := app.DB.AllRoles()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	userRoles, err := app.DB.AllUserRoles()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_ = app.render(w, r, "admin-users.page.gohtml", &TemplateData{Data: map[string]any{
+		"users":     users,
+		"roles":     roles,
+		"userRoles": userRoles,
+	}})
+}
+
+// AdminResetTwoFactor turns off two-factor authentication for a user who
+// has lost both their authenticator app and their recovery codes, and logs
+// them out everywhere, in case someone else is using their account. Only
+// users who have every permission the user has can do it.
+func (app *application) AdminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	ok, err := app.canManage(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !ok {
+		app.Session.Put(r.Context(), "error", app.T(r, "This user has permissions you don't have"))
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = app.DB.DisableTOTP(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.DB.DeleteUserSessions(id, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditTwoFactorReset, id, nil)
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Two-factor authentication has been reset"))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminDeleteUser moves a user to the trash. Admins can't delete themselves, so that
+// there is always someone left to manage the site, nor users who have
+// permissions they don't have.
+func (app *application) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	if user, _ := reqctx.User(r.Context()); user.ID == id {
+		app.Session.Put(r.Context(), "error", app.T(r, "You can't delete yourself"))
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	ok, err := app.canManage(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !ok {
+		app.Session.Put(r.Context(), "error", app.T(r, "This user has permissions you don't have"))
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = app.deleteUser(r, id, nil)
+	if err == sql.ErrNoRows {
+		app.notFound(w, r)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	flash := "User moved to the trash"
+	if app.DeleteGrace == 0 {
+		flash = "User deleted"
+	}
+	app.Session.Put(r.Context(), "flash", app.T(r, flash))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminTrash lists the deleted users who haven't been erased yet, with when
+// they will be.
+func (app *application) AdminTrash(w http.ResponseWriter, r *http.Request) {
+	users, err := app.DB.DeletedUsers()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	purgeAt := make(map[int]time.Time)
+	for _, u := range users {
+		if u.DeletedAt != nil {
+			purgeAt[u.ID] = u.DeletedAt.Add(app.DeleteGrace)
+		}
+	}
+
+	_ = app.render(w, r, "admin-trash.page.gohtml", &TemplateData{Data: map[string]any{
+		"users":   users,
+		"purgeAt": purgeAt,
+	}})
+}
+
+// AdminRestoreUser takes a user out of the trash. They can log in again,
+// but have to log in afresh, since their sessions ended when they were
+// deleted.
+func (app *application) AdminRestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.DB.RestoreUser(id)
+	if err == sql.ErrNoRows {
+		app.Session.Put(r.Context(), "error", app.T(r, "This user isn't in the trash"))
+		http.Redirect(w, r, "/admin/users/trash", http.StatusSeeOther)
+		return
+	}
+	if err == repository.ErrDuplicateEmail {
+		app.Session.Put(r.Context(), "error", app.T(r, "Someone else has this user's email address now, so they can't be restored"))
+		http.Redirect(w, r, "/admin/users/trash", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditUserRestored, id, nil)
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "User restored"))
+	http.Redirect(w, r, "/admin/users/trash", http.StatusSeeOther)
+}
+
+// AdminAssignRole gives a user the role posted in the form.
+func (app *application) AdminAssignRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	role := r.PostForm.Get("role")
+
+	err = app.DB.AssignRole(id, role)
+	if err == sql.ErrNoRows {
+		app.Session.Put(r.Context(), "error", app.T(r, "Unknown role"))
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditRoleAssigned, id, map[string]any{"role": role})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Role %s assigned", role))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminRevokeRole takes a role away from a user.
+func (app *application) AdminRevokeRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	role := chi.URLParam(r, "role")
+
+	// admins can't lock themselves out
+	if user, _ := reqctx.User(r.Context()); user.ID == id && role == data.RoleAdmin {
+		app.Session.Put(r.Context(), "error", app.T(r, "You can't take the admin role away from yourself"))
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err = app.DB.RevokeRole(id, role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditRoleRevoked, id, map[string]any{"role": role})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Role %s revoked", role))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
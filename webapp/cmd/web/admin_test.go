@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+	"webapp/pkg/repository/dbrepo"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func Test_app_RequirePermission(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name         string
+		user         *data.User
+		permission   string
+		expectedCode int
+	}{
+		{"admin", &data.User{ID: 1}, data.PermUsersDelete, http.StatusOK},
+		{"no roles", &data.User{ID: 2}, data.PermUsersRead, http.StatusForbidden},
+		{"is_admin without a role", &data.User{ID: 2, IsAdmin: 1}, data.PermUsersRead, http.StatusForbidden},
+		{"unknown permission", &data.User{ID: 1}, "rockets:launch", http.StatusForbidden},
+		{"not logged in", nil, data.PermUsersRead, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/admin/users", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.user != nil {
+			req = logIn(req, app, *e.user)
+		}
+
+		rr := httptest.NewRecorder()
+		app.RequirePermission(e.permission)(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+// usersRepo is a database with a few users in it.
+type usersRepo struct {
+	repository.DatabaseRepo
+}
+
+func (m *usersRepo) AllUsers() ([]*data.User, error) {
+	return []*data.User{
+		{ID: 1, FirstName: "Admin", Email: "admin@example.com"},
+		{ID: 2, FirstName: "Two", Email: "2fa@example.com", TOTPEnabled: true},
+	}, nil
+}
+
+func Test_app_AdminUsers(t *testing.T) {
+	req := httptest.NewRequest("GET", "/admin/users", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.AdminUsers).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, but got %d", rr.Code)
+	}
+
+	// admins see what they can do to each user
+	testApp := app
+	testApp.DB = &usersRepo{DatabaseRepo: app.DB}
+
+	req = httptest.NewRequest("GET", "/admin/users", nil)
+	req = addContextAndSessionToRequest(req, testApp)
+	req = logIn(req, testApp, data.User{ID: 1})
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testApp.AdminUsers).ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, expected := range []string{"/admin/users/2/delete", "/admin/users/2/reset-2fa", "/admin/users/1/roles/admin/revoke", `<option value="support"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the users page to contain %s", expected)
+		}
+	}
+	if strings.Contains(body, "/admin/users/1/delete") {
+		t.Error("expected admins not to be offered to delete themselves")
+	}
+}
+
+func Test_app_AdminResetTwoFactor(t *testing.T) {
+	var tests = []struct {
+		name         string
+		id           string
+		expectedCode int
+	}{
+		{"valid id", "2", http.StatusSeeOther},
+		{"invalid id", "two", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/admin/users/"+e.id+"/reset-2fa", nil)
+		req = addContextAndSessionToRequest(req, app)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.AdminResetTwoFactor).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+// staffRepo has user 5, who only has the support role, and records what
+// is done to users.
+type staffRepo struct {
+	dbrepo.TestDBRepo
+	totpDisabled  []int
+	sessionsEnded []int
+	deleted       []int
+}
+
+func (m *staffRepo) UserPermissions(userID int) ([]string, error) {
+	if userID == 5 {
+		return []string{data.PermAuditRead, data.PermUsersDelete, data.PermUsersRead, data.PermUsersReset2FA}, nil
+	}
+	return m.TestDBRepo.UserPermissions(userID)
+}
+
+func (m *staffRepo) DisableTOTP(userID int) error {
+	m.totpDisabled = append(m.totpDisabled, userID)
+	return nil
+}
+
+func (m *staffRepo) DeleteUserSessions(userID int, exceptID string) error {
+	if exceptID == "" {
+		m.sessionsEnded = append(m.sessionsEnded, userID)
+	}
+	return nil
+}
+
+func (m *staffRepo) DeleteUser(id int) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+// Test_app_Admin_morePowerfulUser checks that staff can't reset the
+// two-factor authentication of, or delete, a user with permissions they
+// don't have.
+func Test_app_Admin_morePowerfulUser(t *testing.T) {
+	useUploadDir(t)
+
+	var tests = []struct {
+		name          string
+		caller        int
+		target        string
+		expectedError string
+		expectedDone  bool
+	}{
+		{"support on an admin", 5, "1", "This user has permissions you don't have", false},
+		{"support on a user", 5, "2", "", true},
+		{"admin on support", 1, "5", "", true},
+	}
+
+	for _, e := range tests {
+		for _, h := range []string{"reset-2fa", "delete"} {
+			repo := &staffRepo{}
+			testApp := app
+			testApp.DB = repo
+
+			req := httptest.NewRequest("POST", "/admin/users/"+e.target+"/"+h, nil)
+			req = addContextAndSessionToRequest(req, testApp)
+			req = logIn(req, testApp, data.User{ID: e.caller})
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", e.target)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			var done bool
+			if h == "reset-2fa" {
+				http.HandlerFunc(testApp.AdminResetTwoFactor).ServeHTTP(rr, req)
+				done = len(repo.totpDisabled) > 0
+				// whoever has the account now is logged out
+				if done && len(repo.sessionsEnded) == 0 {
+					t.Errorf("%s: expected the user's sessions to be ended", e.name)
+				}
+			} else {
+				http.HandlerFunc(testApp.AdminDeleteUser).ServeHTTP(rr, req)
+				done = len(repo.deleted) > 0
+			}
+
+			if done != e.expectedDone {
+				t.Errorf("%s %s: expected done to be %t, but got %t", e.name, h, e.expectedDone, done)
+			}
+			if msg := testApp.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+				t.Errorf("%s %s: expected error %q, but got %q", e.name, h, e.expectedError, msg)
+			}
+		}
+	}
+}
+
+// adminRequest returns a request by the admin, user 1, with chi url params.
+func adminRequest(method, target string, body url.Values, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1})
+
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func Test_app_AdminDeleteUser(t *testing.T) {
+	// users are erased at once, with their images
+	useUploadDir(t)
+
+	var tests = []struct {
+		name          string
+		id            string
+		grace         time.Duration
+		expectedCode  int
+		expectedFlash string
+		expectedError string
+	}{
+		{"other user", "2", 0, http.StatusSeeOther, "User deleted", ""},
+		{"other user with a grace period", "2", time.Hour, http.StatusSeeOther, "User moved to the trash", ""},
+		{"themselves", "1", 0, http.StatusSeeOther, "", "You can't delete yourself"},
+		{"invalid id", "two", 0, http.StatusNotFound, "", ""},
+	}
+
+	for _, e := range tests {
+		testApp := app
+		testApp.DeleteGrace = e.grace
+		req := adminRequest("POST", "/admin/users/"+e.id+"/delete", nil, map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.AdminDeleteUser).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if flash := app.Session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := app.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func Test_app_AdminTrash(t *testing.T) {
+	testApp := app
+	testApp.DeleteGrace = 48 * time.Hour
+	req := adminRequest("GET", "/admin/users/trash", nil, nil)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.AdminTrash).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, but got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, expected := range []string{"deleted@example.com", "/admin/users/3/restore"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %s in the trash", expected)
+		}
+	}
+}
+
+func Test_app_AdminRestoreUser(t *testing.T) {
+	var tests = []struct {
+		name          string
+		id            string
+		expectedCode  int
+		expectedFlash string
+		expectedError string
+	}{
+		{"deleted user", "3", http.StatusSeeOther, "User restored", ""},
+		{"user not in the trash", "2", http.StatusSeeOther, "", "This user isn't in the trash"},
+		{"email taken", "4", http.StatusSeeOther, "", "Someone else has this user's email address now, so they can't be restored"},
+		{"invalid id", "three", http.StatusNotFound, "", ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/users/"+e.id+"/restore", nil, map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.AdminRestoreUser).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if flash := app.Session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := app.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func Test_app_AdminAssignRole(t *testing.T) {
+	var tests = []struct {
+		name          string
+		role          string
+		expectedFlash string
+		expectedError string
+	}{
+		{"known role", data.RoleSupport, "Role support assigned", ""},
+		{"unknown role", "wizard", "", "Unknown role"},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/users/2/roles", url.Values{"role": {e.role}}, map[string]string{"id": "2"})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.AdminAssignRole).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status 303, but got %d", e.name, rr.Code)
+		}
+		if flash := app.Session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := app.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func Test_app_AdminRevokeRole(t *testing.T) {
+	var tests = []struct {
+		name          string
+		id            string
+		role          string
+		expectedFlash string
+		expectedError string
+	}{
+		{"other user", "2", data.RoleAdmin, "Role admin revoked", ""},
+		{"own admin role", "1", data.RoleAdmin, "", "You can't take the admin role away from yourself"},
+		{"own other role", "1", data.RoleSupport, "Role support revoked", ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/users/"+e.id+"/roles/"+e.role+"/revoke", nil, map[string]string{"id": e.id, "role": e.role})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.AdminRevokeRole).ServeHTTP(rr, req)
+
+		if flash := app.Session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := app.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestTemplateData_Can(t *testing.T) {
+	td := TemplateData{Permissions: []string{data.PermUsersRead}}
+
+	if !td.Can(data.PermUsersRead) {
+		t.Errorf("expected %s to be allowed", data.PermUsersRead)
+	}
+	if td.Can(data.PermUsersDelete) {
+		t.Errorf("expected %s not to be allowed", data.PermUsersDelete)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"webapp/pkg/reqctx"
+)
+
+// writeJSON sends v as a JSON response.
+func (app *application) writeJSON(w http.ResponseWriter, status int, v any) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(out)
+}
+
+// APIMe returns the user the API key belongs to.
+func (app *application) APIMe(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+
+	app.writeJSON(w, http.StatusOK, user)
+}
+
+// APIAudit returns audit events, filtered like the admin audit page.
+func (app *application) APIAudit(w http.ResponseWriter, r *http.Request) {
+	filter, _ := auditFilterFromQuery(r.URL.Query())
+
+	events, err := app.DB.AuditEvents(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, map[string]any{"events": events})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/apikey"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// apiAuth authenticates requests with an API key, sent as
+// "Authorization: Bearer <key>", and puts the key, its user and their
+// permissions in the request context.
+func (app *application) apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+			app.apiUnauthorized(w, r, "missing API key")
+			return
+		}
+		plain := strings.TrimSpace(header[7:])
+
+		prefix, ok := apikey.Prefix(plain)
+		if !ok {
+			app.apiUnauthorized(w, r, "invalid API key")
+			return
+		}
+
+		key, err := app.DB.GetAPIKeyByPrefix(prefix)
+		if err != nil && err != sql.ErrNoRows {
+			app.serverError(w, r, err)
+			return
+		}
+
+		now := time.Now()
+		if err == sql.ErrNoRows || !apikey.Matches(plain, key.Hash) || !key.Active(now) {
+			app.apiUnauthorized(w, r, "invalid API key")
+			return
+		}
+
+		user, err := app.DB.GetUser(key.UserID)
+		if err != nil {
+			app.apiUnauthorized(w, r, "invalid API key")
+			return
+		}
+
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > sessionTouchInterval {
+			if err := app.DB.TouchAPIKey(key.ID, now); err != nil {
+				log.Println("error updating api key:", err)
+			}
+		}
+
+		permissions, err := app.DB.UserPermissions(user.ID)
+		if err != nil {
+			log.Println("error getting permissions:", err)
+		}
+
+		ctx := reqctx.WithAPIKey(r.Context(), key)
+		ctx = reqctx.WithUser(ctx, *user)
+		ctx = reqctx.WithPermissions(ctx, permissions)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireScope only lets through requests made with an API key which was
+// given scope.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := reqctx.APIKey(r.Context())
+			if !ok || !key.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				app.errorResponse(w, r, http.StatusForbidden, "this API key doesn't have the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (app *application) apiUnauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="webapp"`)
+	app.errorResponse(w, r, http.StatusUnauthorized, msg)
+}
+
+// apiKeyLifetimes are the choices of how long a new key lasts, in days; 0
+// never expires.
+var apiKeyLifetimes = []int{30, 90, 365, 0}
+
+// CreateAPIKey generates a new API key for the logged in user, and shows it
+// to them, once.
+func (app *application) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user, _ := reqctx.User(r.Context())
+
+	var input struct {
+		Name    string   `form:"name" validate:"required" message:"Give the key a name"`
+		Scopes  []string `form:"scopes" validate:"required" message:"Choose at least one scope"`
+		Expires int      `form:"expires" validate:"required,min=0" message:"Choose when the key expires"`
+	}
+
+	form := NewForm(r.PostForm)
+	form.Printer = app.printer(r)
+	if err := form.Bind(&input); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	for _, s := range input.Scopes {
+		form.Check(hasPermission(data.APIScopes, s), "scopes", "Unknown scope %s", s)
+	}
+
+	if !form.Valid() {
+		app.stashForm(r, form)
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	key, err := apikey.Generate()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	k := data.APIKey{
+		UserID: user.ID,
+		Name:   input.Name,
+		Prefix: key.Prefix,
+		Hash:   key.Hash,
+		Scopes: input.Scopes,
+	}
+	if input.Expires > 0 {
+		expires := time.Now().AddDate(0, 0, input.Expires)
+		k.ExpiresAt = &expires
+	}
+
+	k.ID, err = app.DB.InsertAPIKey(k)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditAPIKeyCreated, user.ID, map[string]any{"prefix": k.Prefix, "scopes": k.Scopes})
+
+	_ = app.render(w, r, "api-key.page.gohtml", &TemplateData{Data: map[string]any{
+		"key":   k,
+		"plain": key.Plain,
+	}})
+}
+
+// RevokeAPIKey revokes one of the logged in user's API keys.
+func (app *application) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	user, _ := reqctx.User(r.Context())
+
+	err = app.DB.RevokeAPIKey(id, user.ID)
+	if err == sql.ErrNoRows {
+		app.notFound(w, r)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditAPIKeyRevoked, user.ID, map[string]any{"id": id})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "API key revoked"))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
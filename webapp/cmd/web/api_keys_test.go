@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/reqctx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func Test_app_apiAuth(t *testing.T) {
+	var tests = []struct {
+		name          string
+		authorization string
+		expectedCode  int
+	}{
+		{"valid key", "Bearer " + dbrepo.TestAPIKey, http.StatusOK},
+		{"lower case scheme", "bearer " + dbrepo.TestAPIKey, http.StatusOK},
+		{"no header", "", http.StatusUnauthorized},
+		{"basic auth", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"not a key", "Bearer hello", http.StatusUnauthorized},
+		{"unknown prefix", "Bearer wak_unknownn_secret", http.StatusUnauthorized},
+		{"wrong secret", "Bearer wak_testtest_guess", http.StatusUnauthorized},
+		{"revoked", "Bearer " + dbrepo.TestRevokedAPIKey, http.StatusUnauthorized},
+		{"expired", "Bearer " + dbrepo.TestExpiredAPIKey, http.StatusUnauthorized},
+	}
+
+	var user data.User
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ = reqctx.User(r.Context())
+	})
+
+	for _, e := range tests {
+		user = data.User{}
+
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		app.apiAuth(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if e.expectedCode == http.StatusOK && user.ID != 1 {
+			t.Errorf("%s: expected user 1 in the context, but got %d", e.name, user.ID)
+		}
+		if e.expectedCode == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", e.name)
+		}
+	}
+}
+
+func Test_app_api_routes(t *testing.T) {
+	var tests = []struct {
+		name         string
+		url          string
+		key          string
+		expectedCode int
+		expectedBody string
+	}{
+		{"me", "/api/me", dbrepo.TestAPIKey, http.StatusOK, `"id":1`},
+		{"audit", "/api/audit?type=login", dbrepo.TestAPIKey, http.StatusOK, `"events":[`},
+		{"audit without the scope", "/api/audit", dbrepo.TestProfileAPIKey, http.StatusForbidden, "audit:read scope"},
+		{"no key", "/api/me", "", http.StatusUnauthorized, "missing API key"},
+	}
+
+	routes := app.routes()
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		if e.key != "" {
+			req.Header.Set("Authorization", "Bearer "+e.key)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected a JSON response, but got %s", e.name, ct)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected %s in %s", e.name, e.expectedBody, rr.Body.String())
+		}
+	}
+}
+
+func Test_app_CreateAPIKey(t *testing.T) {
+	var tests = []struct {
+		name          string
+		postedData    url.Values
+		expectedCode  int
+		expectedField string
+		expectedError string
+	}{
+		{"valid", url.Values{"name": {"backups"}, "scopes": {data.ScopeProfileRead}, "expires": {"30"}}, http.StatusOK, "", ""},
+		{"never expires", url.Values{"name": {"backups"}, "scopes": {data.ScopeProfileRead, data.ScopeAuditRead}, "expires": {"0"}}, http.StatusOK, "", ""},
+		{"no name", url.Values{"name": {" "}, "scopes": {data.ScopeProfileRead}, "expires": {"30"}}, http.StatusSeeOther, "name", "Give the key a name"},
+		{"no scopes", url.Values{"name": {"backups"}, "expires": {"30"}}, http.StatusSeeOther, "scopes", "Choose at least one scope"},
+		{"unknown scope", url.Values{"name": {"backups"}, "scopes": {"rockets:launch"}, "expires": {"30"}}, http.StatusSeeOther, "scopes", "Unknown scope rockets:launch"},
+		{"bad expiry", url.Values{"name": {"backups"}, "scopes": {data.ScopeProfileRead}, "expires": {"-1"}}, http.StatusSeeOther, "expires", "Choose when the key expires"},
+		{"expiry not a number", url.Values{"name": {"backups"}, "scopes": {data.ScopeProfileRead}, "expires": {"soon"}}, http.StatusSeeOther, "expires", "Choose when the key expires"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/user/api-keys", strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: 1})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.CreateAPIKey).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if e.expectedCode == http.StatusOK && !strings.Contains(rr.Body.String(), "wak_") {
+			t.Errorf("%s: expected the new key to be shown", e.name)
+		}
+		form := app.popForm(req)
+		if msg := form.Errors.Get(e.expectedField); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+		if e.expectedError != "" && form.Data.Get("name") != e.postedData.Get("name") {
+			t.Errorf("%s: expected the name to be kept, but got %q", e.name, form.Data.Get("name"))
+		}
+	}
+}
+
+func Test_app_CreateAPIKey_scopesError(t *testing.T) {
+	postedData := url.Values{"name": {"backups"}, "expires": {"30"}}
+	req := httptest.NewRequest("POST", "/user/api-keys", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1})
+	http.HandlerFunc(app.CreateAPIKey).ServeHTTP(httptest.NewRecorder(), req)
+
+	// the checkboxes have no input of their own to show the error under, so
+	// it has to be shown even without one
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.Profile).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `<div class="invalid-feedback d-block">Choose at least one scope</div>`) {
+		t.Error("expected the scopes error on the profile page")
+	}
+}
+
+func Test_app_RevokeAPIKey(t *testing.T) {
+	var tests = []struct {
+		name         string
+		id           string
+		userID       int
+		expectedCode int
+	}{
+		{"own key", "1", 1, http.StatusSeeOther},
+		{"someone else's key", "1", 2, http.StatusNotFound},
+		{"invalid id", "one", 1, http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/user/api-keys/"+e.id+"/revoke", nil)
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: e.userID})
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.RevokeAPIKey).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
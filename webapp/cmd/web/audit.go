@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
+)
+
+// auditPageSize is the number of audit events shown per page.
+const auditPageSize = 50
+
+// audit records a security relevant event. The actor is whoever is logged
+// in at the time, if anyone. Failing to write the audit log is logged, but
+// never fails the request.
+func (app *application) audit(r *http.Request, eventType string, targetUserID int, details map[string]any) {
+	e := data.AuditEvent{
+		TargetUserID: targetUserID,
+		UserAgent:    r.UserAgent(),
+		Type:         eventType,
+		Details:      details,
+		CreatedAt:    time.Now(),
+	}
+
+	if ip, ok := reqctx.IP(r.Context()); ok {
+		e.IP = ip
+	}
+
+	// the session rather than the request context, so that a user who
+	// logged in during this request is the actor of their own login
+	if user, ok := app.Session.Get(r.Context(), "user").(data.User); ok {
+		e.ActorID = user.ID
+	}
+
+	if _, err := app.DB.InsertAuditEvent(e); err != nil {
+		log.Println("error writing audit log:", err)
+	}
+}
+
+// auditFilterFromQuery reads the filters of the audit page from the query
+// string. Values that don't parse are ignored.
+func auditFilterFromQuery(q url.Values) (data.AuditFilter, int) {
+	f := data.AuditFilter{
+		Type:  q.Get("type"),
+		Limit: auditPageSize,
+	}
+
+	if id, err := strconv.Atoi(q.Get("user")); err == nil {
+		f.UserID = id
+	}
+
+	if since, err := time.Parse("2006-01-02", q.Get("from")); err == nil {
+		f.Since = since
+	}
+
+	if until, err := time.Parse("2006-01-02", q.Get("to")); err == nil {
+		// include the whole of the last day
+		f.Until = until.AddDate(0, 0, 1)
+	}
+
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	f.Offset = (page - 1) * auditPageSize
+
+	return f, page
+}
+
+// AdminAudit shows the audit log, newest first, optionally filtered by
+// event type, user and date.
+func (app *application) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	filter, page := auditFilterFromQuery(r.URL.Query())
+
+	events, err := app.DB.AuditEvents(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// links to the neighbouring pages keep the current filters
+	q := r.URL.Query()
+	pageURL := func(p int) string {
+		q.Set("page", strconv.Itoa(p))
+		return "/admin/audit?" + q.Encode()
+	}
+
+	td := map[string]any{
+		"events": events,
+		"types":  data.AuditEventTypes,
+		"filter": r.URL.Query(),
+		"page":   page,
+	}
+	if page > 1 {
+		td["prev"] = pageURL(page - 1)
+	}
+	if len(events) == auditPageSize {
+		td["next"] = pageURL(page + 1)
+	}
+
+	_ = app.render(w, r, "admin-audit.page.gohtml", &TemplateData{Data: td})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+)
+
+// auditRecorder is a database that keeps the audit events written to it.
+type auditRecorder struct {
+	repository.DatabaseRepo
+	events []data.AuditEvent
+}
+
+func (m *auditRecorder) InsertAuditEvent(e data.AuditEvent) (int, error) {
+	m.events = append(m.events, e)
+	return len(m.events), nil
+}
+
+func Test_app_audit(t *testing.T) {
+	db := &auditRecorder{DatabaseRepo: app.DB}
+	testApp := app
+	testApp.DB = db
+
+	req := httptest.NewRequest("POST", "/admin/users/2/reset-2fa", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	req = addContextAndSessionToRequest(req, testApp)
+	req = logIn(req, testApp, data.User{ID: 1, IsAdmin: 1})
+
+	testApp.audit(req, data.AuditTwoFactorReset, 2, map[string]any{"why": "lost phone"})
+
+	if len(db.events) != 1 {
+		t.Fatalf("expected 1 audit event, but got %d", len(db.events))
+	}
+
+	e := db.events[0]
+	if e.Type != data.AuditTwoFactorReset || e.ActorID != 1 || e.TargetUserID != 2 {
+		t.Errorf("unexpected audit event %+v", e)
+	}
+	if e.UserAgent != "test-agent" {
+		t.Errorf("expected user agent test-agent, but got %q", e.UserAgent)
+	}
+	if e.IP == "" {
+		t.Error("expected the ip to be recorded")
+	}
+}
+
+func Test_app_Login_audit(t *testing.T) {
+	var tests = []struct {
+		name         string
+		email        string
+		password     string
+		expectedType string
+		expectedUser int
+	}{
+		{"valid login", "admin@example.com", "secret", data.AuditLogin, 1},
+		{"wrong password", "admin@example.com", "wrong", data.AuditLoginFailed, 1},
+		{"unknown email", "nobody@example.com", "secret", data.AuditLoginFailed, 0},
+	}
+
+	for _, e := range tests {
+		db := &auditRecorder{DatabaseRepo: app.DB}
+		testApp := app
+		testApp.DB = db
+
+		postedData := url.Values{"email": {e.email}, "password": {e.password}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, testApp)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.Login).ServeHTTP(rr, req)
+
+		if len(db.events) != 1 {
+			t.Errorf("%s: expected 1 audit event, but got %d", e.name, len(db.events))
+			continue
+		}
+		if db.events[0].Type != e.expectedType {
+			t.Errorf("%s: expected event %s, but got %s", e.name, e.expectedType, db.events[0].Type)
+		}
+		if db.events[0].TargetUserID != e.expectedUser {
+			t.Errorf("%s: expected target user %d, but got %d", e.name, e.expectedUser, db.events[0].TargetUserID)
+		}
+	}
+}
+
+func Test_auditFilterFromQuery(t *testing.T) {
+	q := url.Values{
+		"type": {data.AuditLogin},
+		"user": {"7"},
+		"from": {"2022-08-01"},
+		"to":   {"2022-08-31"},
+		"page": {"3"},
+	}
+
+	f, page := auditFilterFromQuery(q)
+
+	if f.Type != data.AuditLogin || f.UserID != 7 {
+		t.Errorf("unexpected filter %+v", f)
+	}
+	if !f.Since.Equal(time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected since %s", f.Since)
+	}
+	if !f.Until.Equal(time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected until %s", f.Until)
+	}
+	if page != 3 || f.Offset != 2*auditPageSize || f.Limit != auditPageSize {
+		t.Errorf("unexpected paging: page %d, offset %d, limit %d", page, f.Offset, f.Limit)
+	}
+
+	f, page = auditFilterFromQuery(url.Values{"user": {"x"}, "from": {"yesterday"}, "page": {"-1"}})
+	if f.UserID != 0 || !f.Since.IsZero() || page != 1 || f.Offset != 0 {
+		t.Errorf("expected bad values to be ignored, but got %+v, page %d", f, page)
+	}
+}
+
+func Test_app_AdminAudit(t *testing.T) {
+	req := httptest.NewRequest("GET", "/admin/audit?type=login&page=2", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.AdminAudit).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, but got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "127.0.0.1") {
+		t.Error("expected the audit events to be listed")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+)
+
+// csrfFieldName is the form field, and csrfHeader the header, that carry
+// the CSRF token of the session.
+const (
+	csrfFieldName = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// maxFormSize is the most we read of a request which changes something,
+// uploads included, and csrfFormMemory how much of a multipart form is
+// kept in memory while looking for the token; the rest goes to temporary
+// files. Without them, any post could make us hold 32MB in memory before
+// it was turned away.
+const (
+	maxFormSize    = maxUploadSize + 1024*1024
+	csrfFormMemory = 64 * 1024
+)
+
+// csrfToken returns the CSRF token of the session, and starts one if there
+// isn't one yet.
+func (app *application) csrfToken(r *http.Request) string {
+	token := app.Session.GetString(r.Context(), "csrf_token")
+	if token != "" {
+		return token
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		log.Println("error creating csrf token:", err)
+		return ""
+	}
+	app.Session.Put(r.Context(), "csrf_token", token)
+
+	return token
+}
+
+// csrf rejects requests which change something, unless they carry the CSRF
+// token of the session, so that other sites can't post forms on behalf of
+// our users. The API, which authenticates with a Bearer key rather than a
+// cookie, doesn't use it.
+func (app *application) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+
+		sent := r.Header.Get(csrfHeader)
+		if sent == "" {
+			// handlers parsing the form later get this one; ParseForm is
+			// called first, as ParseMultipartForm hides its errors
+			err := r.ParseForm()
+			if err == nil {
+				err = r.ParseMultipartForm(csrfFormMemory)
+			}
+			if err != nil && err != http.ErrNotMultipart {
+				app.clientError(w, r, http.StatusBadRequest)
+				return
+			}
+			sent = r.PostForm.Get(csrfFieldName)
+		}
+
+		token := app.Session.GetString(r.Context(), "csrf_token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			app.errorResponse(w, r, http.StatusForbidden, "This form has expired, please go back, reload the page and try again.")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_csrf(t *testing.T) {
+	var tests = []struct {
+		name          string
+		method        string
+		formToken     string
+		headerToken   string
+		authorization string
+		expectedCode  int
+	}{
+		{"get", "GET", "", "", "", http.StatusOK},
+		{"post without a token", "POST", "", "", "", http.StatusForbidden},
+		{"post with a wrong token", "POST", "wrong", "", "", http.StatusForbidden},
+		{"post with the form token", "POST", "session", "", "", http.StatusOK},
+		{"post with the header token", "POST", "", "session", "", http.StatusOK},
+		{"bearer key is no exception", "POST", "", "", "Bearer wak_testtest_secret", http.StatusForbidden},
+		{"basic auth is no exception", "POST", "", "", "Basic dXNlcjpwYXNz", http.StatusForbidden},
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, "/user/api-keys", nil)
+		req = addContextAndSessionToRequest(req, app)
+		token := app.csrfToken(req)
+
+		form := url.Values{}
+		if e.formToken == "session" {
+			form.Set(csrfFieldName, token)
+		} else if e.formToken != "" {
+			form.Set(csrfFieldName, e.formToken)
+		}
+		if len(form) > 0 {
+			req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if e.headerToken == "session" {
+			req.Header.Set(csrfHeader, token)
+		}
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		app.csrf(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_csrf_formSize(t *testing.T) {
+	var tests = []struct {
+		name         string
+		contentType  string
+		body         func(token string) string
+		expectedCode int
+	}{
+		{"too big", "application/x-www-form-urlencoded", func(token string) string {
+			return csrfFieldName + "=" + token + "&padding=" + strings.Repeat("a", maxFormSize)
+		}, http.StatusBadRequest},
+		{"multipart", "multipart/form-data; boundary=b", func(token string) string {
+			return "--b\r\nContent-Disposition: form-data; name=\"" + csrfFieldName + "\"\r\n\r\n" + token + "\r\n--b--\r\n"
+		}, http.StatusOK},
+	}
+
+	for _, e := range tests {
+		var called bool
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			// the handler gets the form the token was found in
+			if r.PostForm.Get(csrfFieldName) == "" {
+				t.Errorf("%s: expected the parsed form in the handler", e.name)
+			}
+		})
+
+		req := httptest.NewRequest("POST", "/user/upload-profile-pic", nil)
+		req = addContextAndSessionToRequest(req, app)
+		req.Body = io.NopCloser(strings.NewReader(e.body(app.csrfToken(req))))
+		req.Header.Set("Content-Type", e.contentType)
+
+		rr := httptest.NewRecorder()
+		app.csrf(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if called != (e.expectedCode == http.StatusOK) {
+			t.Errorf("%s: expected the handler to be called to be %t, but got %t", e.name, e.expectedCode == http.StatusOK, called)
+		}
+	}
+}
+
+func Test_app_csrfToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	token := app.csrfToken(req)
+	if len(token) < 32 {
+		t.Errorf("expected a long random token, but got %q", token)
+	}
+	if again := app.csrfToken(req); again != token {
+		t.Error("expected the token to stay the same for the session")
+	}
+}
+
+func Test_app_render_csrfField(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	rr := httptest.NewRecorder()
+
+	_ = app.render(rr, req, "home.page.gohtml", &TemplateData{Data: map[string]any{}})
+
+	if !strings.Contains(rr.Body.String(), `value="`+app.csrfToken(req)+`"`) {
+		t.Error("expected the login form to carry the csrf token of the session")
+	}
+}
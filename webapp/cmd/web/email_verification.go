@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+	"webapp/pkg/reqctx"
+	"webapp/pkg/tokens"
+)
+
+const (
+	// verifyEmailPurpose is what verification tokens are signed for, so
+	// that they can't be used for anything else.
+	verifyEmailPurpose = "verify-email"
+	// verifyEmailLifetime is how long a verification link works for.
+	verifyEmailLifetime = 48 * time.Hour
+)
+
+// signerFromKey returns a token signer for a hex encoded key. Without a key
+// a random one is used, and links sent before a restart stop working.
+func signerFromKey(hexKey string) (*tokens.Signer, error) {
+	if hexKey == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		log.Println("no -signing-key given, verification links will stop working on restart")
+		return tokens.NewSigner(key), nil
+	}
+
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	if len(key) < 32 {
+		return nil, fmt.Errorf("signing key: need at least 32 bytes, got %d", len(key))
+	}
+	return tokens.NewSigner(key), nil
+}
+
+// absoluteURL turns a path into a link that works outside of the site, eg
+// in an email. It is never built from the Host header, which the client
+// controls, or anyone could have links to their own site sent out by us.
+func (app *application) absoluteURL(path string) string {
+	return app.BaseURL + path
+}
+
+// sendVerificationEmail mails the user a link which proves they own their
+// email address.
+func (app *application) sendVerificationEmail(user *data.User) error {
+	token := app.Tokens.Sign(verifyEmailPurpose, user.ID, user.Email, time.Now().Add(verifyEmailLifetime))
+	link := app.absoluteURL(routePattern("verify-email") + "?token=" + url.QueryEscape(token))
+
+	return app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Please verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by opening this link:\n\n%s\n\nThe link works for %d hours.\n",
+			user.FirstName, link, int(verifyEmailLifetime.Hours())),
+	})
+}
+
+// VerifyEmail marks an email address as verified when the link we sent to
+// it is opened.
+func (app *application) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	userID, email, err := app.Tokens.Verify(r.URL.Query().Get("token"), verifyEmailPurpose, time.Now())
+	if err == tokens.ErrExpired {
+		app.Session.Put(r.Context(), "error", app.T(r, "This link has expired, please ask for a new one"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid verification link"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err = app.DB.VerifyEmail(userID, email)
+	if err == sql.ErrNoRows {
+		// the user changed their address after the link was sent
+		app.Session.Put(r.Context(), "error", app.T(r, "This link is for an old email address"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditEmailVerified, userID, map[string]any{"email": email})
+
+	// refresh the user in the session, if it's them
+	if user, ok := reqctx.User(r.Context()); ok && user.ID == userID {
+		updatedUser, err := app.DB.GetUser(userID)
+		if err == nil {
+			app.putSessionUser(r, *updatedUser)
+		}
+		app.Session.Put(r.Context(), "flash", app.T(r, "Your email address has been verified"))
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Your email address has been verified, please log in"))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// ResendVerificationEmail sends the logged in user a new verification link.
+func (app *application) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+
+	if user.EmailVerified() {
+		app.Session.Put(r.Context(), "flash", app.T(r, "Your email address is already verified"))
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.sendVerificationEmail(&user); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "We've sent a verification link to %s", user.Email))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
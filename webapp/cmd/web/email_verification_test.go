@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+)
+
+func Test_signerFromKey(t *testing.T) {
+	var tests = []struct {
+		name        string
+		key         string
+		expectedErr bool
+	}{
+		{"random", "", false},
+		{"valid", strings.Repeat("ab", 32), false},
+		{"too short", "abcd", true},
+		{"not hex", strings.Repeat("zz", 32), true},
+	}
+
+	for _, e := range tests {
+		_, err := signerFromKey(e.key)
+		if (err != nil) != e.expectedErr {
+			t.Errorf("%s: expected error %t, but got %v", e.name, e.expectedErr, err)
+		}
+	}
+}
+
+func Test_app_ResendVerificationEmail(t *testing.T) {
+	mail := &mailer.MemoryMailer{}
+	testApp := app
+	testApp.Mailer = mail
+	testApp.BaseURL = "https://webapp.example.com"
+
+	// the link doesn't follow a forged Host header
+	req := httptest.NewRequest("POST", "/user/verify-email", nil)
+	req.Host = "evil.example.com"
+	req = addContextAndSessionToRequest(req, testApp)
+	req = logIn(req, testApp, data.User{ID: 1, FirstName: "Admin", Email: "admin@example.com"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.ResendVerificationEmail).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected status 303, but got %d", rr.Code)
+	}
+
+	msg, ok := mail.Last()
+	if !ok {
+		t.Fatal("expected a verification email, but none was sent")
+	}
+	if msg.To != "admin@example.com" {
+		t.Errorf("expected email to admin@example.com, but got %s", msg.To)
+	}
+	if !strings.Contains(msg.Body, "https://webapp.example.com/verify-email?token=") {
+		t.Errorf("expected a verification link in %q", msg.Body)
+	}
+
+	// no email for verified users
+	verified := time.Now()
+	req = logIn(req, testApp, data.User{ID: 1, Email: "admin@example.com", EmailVerifiedAt: &verified})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testApp.ResendVerificationEmail).ServeHTTP(rr, req)
+
+	if len(mail.Messages()) != 1 {
+		t.Errorf("expected no email for a verified user, but got %d emails", len(mail.Messages()))
+	}
+}
+
+func Test_app_VerifyEmail(t *testing.T) {
+	var tests = []struct {
+		name          string
+		token         string
+		loggedIn      bool
+		expectedLoc   string
+		expectedFlash string
+		expectedError string
+	}{
+		{"valid", app.Tokens.Sign(verifyEmailPurpose, 1, "admin@example.com", time.Now().Add(time.Hour)), false, "/", "Your email address has been verified, please log in", ""},
+		{"valid and logged in", app.Tokens.Sign(verifyEmailPurpose, 1, "admin@example.com", time.Now().Add(time.Hour)), true, "/user/profile", "Your email address has been verified", ""},
+		{"expired", app.Tokens.Sign(verifyEmailPurpose, 1, "admin@example.com", time.Now().Add(-time.Hour)), false, "/", "", "This link has expired, please ask for a new one"},
+		{"changed address", app.Tokens.Sign(verifyEmailPurpose, 1, "changed@example.com", time.Now().Add(time.Hour)), false, "/", "", "This link is for an old email address"},
+		{"wrong purpose", app.Tokens.Sign("reset-password", 1, "admin@example.com", time.Now().Add(time.Hour)), false, "/", "", "Invalid verification link"},
+		{"garbage", "nonsense", false, "/", "", "Invalid verification link"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/verify-email?token="+url.QueryEscape(e.token), nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.loggedIn {
+			req = logIn(req, app, data.User{ID: 1})
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.VerifyEmail).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status 303, but got %d", e.name, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+		if flash := app.Session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := app.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func Test_app_Login_requireVerified(t *testing.T) {
+	mail := &mailer.MemoryMailer{}
+	testApp := app
+	testApp.Mailer = mail
+	testApp.RequireVerified = true
+
+	postedData := url.Values{"email": {"admin@example.com"}, "password": {"secret"}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, testApp)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.Login).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("expected an unverified user to be sent back to /, but got %s", loc)
+	}
+	if testApp.Session.Exists(req.Context(), "user") {
+		t.Error("expected an unverified user not to be logged in")
+	}
+	if len(mail.Messages()) != 1 {
+		t.Errorf("expected a new verification link to be sent, but got %d emails", len(mail.Messages()))
+	}
+}
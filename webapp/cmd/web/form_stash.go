@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// formKey is the session key of a stashed form.
+const formKey = "form"
+
+// stashedForm is what is kept of a form in the session, between a post
+// which failed and the page it redirects to.
+type stashedForm struct {
+	Data   url.Values
+	Errors map[string][]string
+}
+
+// stashForm keeps the values and errors of form in the session, so that the
+// page the client is redirected to can show them again, and the user
+// doesn't have to fill in the form again. Passwords and the CSRF token are
+// never kept.
+func (app *application) stashForm(r *http.Request, form *Form) {
+	values := url.Values{}
+	for field, v := range form.Data {
+		if field == csrfFieldName || strings.Contains(strings.ToLower(field), "password") {
+			continue
+		}
+		values[field] = v
+	}
+
+	app.Session.Put(r.Context(), formKey, stashedForm{Data: values, Errors: form.Errors})
+}
+
+// popForm returns the form stashed by the previous request, or an empty
+// form if there isn't one.
+func (app *application) popForm(r *http.Request) *Form {
+	form := NewForm(url.Values{})
+	form.Printer = app.printer(r)
+
+	if stashed, ok := app.Session.Pop(r.Context(), formKey).(stashedForm); ok {
+		form.Data = stashed.Data
+		if stashed.Errors != nil {
+			form.Errors = stashed.Errors
+		}
+	}
+
+	return form
+}
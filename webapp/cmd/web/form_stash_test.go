@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_app_stashForm(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	form := NewForm(url.Values{
+		"email":        {"jack@example.com"},
+		"password":     {"secret"},
+		"new_password": {"secret"},
+		csrfFieldName:  {"token"},
+	})
+	form.Errors.Add("password", "This field cannot be blank")
+	app.stashForm(req, form)
+
+	popped := app.popForm(req)
+	if popped.Data.Get("email") != "jack@example.com" {
+		t.Errorf("expected the email to be kept, but got %v", popped.Data)
+	}
+	for _, field := range []string{"password", "new_password", csrfFieldName} {
+		if popped.Data.Has(field) {
+			t.Errorf("expected %s not to be kept", field)
+		}
+	}
+	if popped.Errors.Get("password") == "" {
+		t.Error("expected the errors to be kept")
+	}
+
+	// the form is shown once
+	again := app.popForm(req)
+	if len(again.Data) != 0 || !again.Valid() {
+		t.Errorf("expected an empty form, but got %+v", again)
+	}
+}
+
+func Test_app_render_stashedForm(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	form := NewForm(url.Values{"email": {"jack@example.com"}})
+	form.Errors.Add("password", "This field cannot be blank")
+	app.stashForm(req, form)
+
+	rr := httptest.NewRecorder()
+	_ = app.render(rr, req, "home.page.gohtml", &TemplateData{})
+
+	body := rr.Body.String()
+	for _, expected := range []string{`value="jack@example.com"`, `class="form-control is-invalid" id="password"`, `<div class="invalid-feedback">This field cannot be blank</div>`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in the page", expected)
+		}
+	}
+}
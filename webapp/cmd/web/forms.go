@@ -1,8 +1,12 @@
 package main
 
 import (
+	"mime/multipart"
 	"net/url"
 	"strings"
+	"webapp/pkg/i18n"
+	"webapp/pkg/passwords"
+	"webapp/pkg/validate"
 )
 
 // errors is a convenience type, so that we can have a function tied to our map.
@@ -25,7 +29,10 @@ func (e errors) Add(field, message string) {
 // Form is the type used to instantiate form validation
 type Form struct {
 	Data url.Values
+	Files map[string][]*multipart.FileHeader
 	Errors errors
+	// Printer translates error messages; they stay in English without one.
+	Printer *i18n.Printer
 }
 
 // NewForm initializes a form struct
@@ -36,6 +43,13 @@ func NewForm(data url.Values) *Form {
 	}
 }
 
+// NewMultipartForm initializes a form struct with uploaded files
+func NewMultipartForm(m *multipart.Form) *Form {
+	f := NewForm(m.Value)
+	f.Files = m.File
+	return f
+}
+
 // Has checks to see if the form has a given field
 func (f *Form) Has(field string) bool {
 	x := f.Data.Get(field)
@@ -50,17 +64,40 @@ func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Data.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field cannot be blank")
+			f.Errors.Add(field, f.Printer.T("This field cannot be blank"))
 		}
 	}
 }
 
 // Check is a generic validation check. We can pass any expression
-// that evaluates as a boolean as the first parameter.
-func (f *Form) Check(ok bool, key, message string) {
+// that evaluates as a boolean as the first parameter. The message is
+// translated, and then formatted with args.
+func (f *Form) Check(ok bool, key, message string, args ...any) {
 	if !ok {
-		f.Errors.Add(key, message)
+		f.Errors.Add(key, f.Printer.T(message, args...))
+	}
+}
+
+// Password checks a field against a password policy
+func (f *Form) Password(field string, policy *passwords.Policy) {
+	for _, problem := range policy.Problems(f.Data.Get(field)) {
+		f.Errors.Add(field, f.Printer.T(problem.Message, problem.Args...))
+	}
+}
+
+// Bind copies the form into the struct dst points to, and checks it
+// against the validate tags of its fields. Problems are added to the errors;
+// the returned error is for a dst which can't be bound, which is a bug.
+func (f *Form) Bind(dst any) error {
+	problems, err := validate.Bind(dst, f.Data, f.Files)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		f.Errors.Add(problem.Field, f.Printer.T(problem.Message, problem.Args...))
 	}
+	return nil
 }
 
 // Valid returns true if there are no errors, otherwise false
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"webapp/pkg/passwords"
 )
 
 func TestForm_Has(t *testing.T) {
@@ -72,4 +73,75 @@ func TestForm_ErrorGet(t *testing.T) {
 	if len(s) != 0 {
 		t.Error("should not have an error, but got one")
 	}
-}
\ No newline at end of file
+}
+
+func TestForm_Password(t *testing.T) {
+	policy := passwords.DefaultPolicy()
+
+	form := NewForm(url.Values{"password": {"password"}})
+	form.Password("password", policy)
+	if form.Valid() {
+		t.Error("form shows valid with a breached password")
+	}
+
+	form = NewForm(url.Values{"password": {"correct horse battery"}})
+	form.Password("password", policy)
+	if !form.Valid() {
+		t.Errorf("form shows invalid with a good password: %v", form.Errors)
+	}
+}
+
+func TestForm_translated(t *testing.T) {
+	form := NewForm(url.Values{"password": {"password"}})
+	form.Printer = app.I18n.Printer("de")
+
+	form.Required("email")
+	form.Check(false, "scopes", "Unknown scope %s", "nope")
+	form.Password("password", passwords.DefaultPolicy())
+
+	var tests = []struct {
+		field    string
+		expected string
+	}{
+		{"email", "Dieses Feld darf nicht leer sein"},
+		{"scopes", "Unbekannte Berechtigung nope"},
+		{"password", "Dieses Passwort ist in einem Datenleck aufgetaucht, bitte wähle ein anderes"},
+	}
+
+	for _, e := range tests {
+		if got := form.Errors.Get(e.field); got != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.field, e.expected, got)
+		}
+	}
+}
+
+func TestForm_Bind(t *testing.T) {
+	var input struct {
+		Email   string `form:"email" validate:"required,email"`
+		Name    string `form:"name" validate:"required"`
+		Confirm string `form:"confirm" validate:"eqfield=Email"`
+	}
+
+	form := NewForm(url.Values{"email": {"jack@example.com"}, "confirm": {"jack@example.org"}})
+	form.Printer = app.I18n.Printer("de")
+	if err := form.Bind(&input); err != nil {
+		t.Fatal(err)
+	}
+
+	if form.Valid() {
+		t.Error("form shows valid without a name")
+	}
+	if input.Email != "jack@example.com" {
+		t.Errorf("expected the email to be bound, but got %q", input.Email)
+	}
+	if got := form.Errors.Get("name"); got != "Dieses Feld darf nicht leer sein" {
+		t.Errorf("unexpected error for name %q", got)
+	}
+	if got := form.Errors.Get("confirm"); got != "Das stimmt nicht überein" {
+		t.Errorf("unexpected error for confirm %q", got)
+	}
+
+	if err := form.Bind(input); err == nil {
+		t.Error("expected an error binding into a struct value")
+	}
+}
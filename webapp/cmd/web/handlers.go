@@ -1,19 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"path"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/reqctx"
 )
 
-var pathToTemplates = "./templates/"
+var staticPath = "./static"
 var uploadPath = "./static/img"
 
 func (app *application) Home(w http.ResponseWriter, r *http.Request) {
@@ -25,63 +30,148 @@ func (app *application) Home(w http.ResponseWriter, r *http.Request) {
 	} else {
 		app.Session.Put(r.Context(), "test", "Hit this page at "+time.Now().UTC().String())
 	}
+	if app.OIDC != nil {
+		td["oidc"] = app.OIDCName
+	}
 	_ = app.render(w, r, "home.page.gohtml", &TemplateData{Data: td})
 }
 
 func (app *application) Profile(w http.ResponseWriter, r *http.Request) {
+	var td = make(map[string]any)
+
+	if app.OIDC != nil {
+		td["oidc"] = app.OIDCName
+	}
 
-	_ = app.render(w, r, "profile.page.gohtml", &TemplateData{})
+	user, _ := reqctx.User(r.Context())
+	keys, err := app.DB.AllAPIKeys(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	td["apiKeys"] = keys
+	td["apiScopes"] = data.APIScopes
+	td["apiKeyLifetimes"] = apiKeyLifetimes
+	td["now"] = time.Now()
+
+	_ = app.render(w, r, "profile.page.gohtml", &TemplateData{Data: td})
 }
 
 type TemplateData struct {
-	IP    string
-	Data  map[string]any
-	Error string
-	Flash string
-	User  data.User
+	IP          string
+	Data        map[string]any
+	Error       string
+	Flash       string
+	User        data.User
+	Permissions []string
+	Nonce       string
+	CSRFToken   string
+	Form        *Form
+	Locale      string
+	Languages   []i18n.Language
+	printer     *i18n.Printer
+}
+
+// Can reports whether the logged in user has a permission, so that
+// templates only show what the user is allowed to do.
+func (td *TemplateData) Can(permission string) bool {
+	return hasPermission(td.Permissions, permission)
 }
 
+// render sends the page t with a 200 status. When rendering fails, the
+// client gets an error page instead, so callers only need the returned
+// error if they want to do something else as well.
 func (app *application) render(w http.ResponseWriter, r *http.Request, t string, td *TemplateData) error {
-	// parse the template from disk.
-	parsedTemplate, err := template.ParseFiles(path.Join(pathToTemplates, t), path.Join(pathToTemplates, "base.layout.gohtml"))
+	return app.renderStatus(w, r, http.StatusOK, t, td)
+}
+
+// renderStatus sends the page t with status.
+func (app *application) renderStatus(w http.ResponseWriter, r *http.Request, status int, t string, td *TemplateData) error {
+	// get the parsed template from the cache
+	parsedTemplate, err := app.Templates.get(t)
 	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		// a missing or broken template is our fault, not the client's
+		app.serverError(w, r, err)
 		return err
 	}
 
 	td.IP = app.ipFromContext(r.Context())
+	td.Nonce = app.nonceFromContext(r.Context())
+	td.CSRFToken = app.csrfToken(r)
+	app.addLocale(r, td)
 
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Flash = app.Session.PopString(r.Context(), "flash")
+	if td.Form == nil {
+		td.Form = app.popForm(r)
+	}
 
-	if app.Session.Exists(r.Context(), "user") { //pass the user to the template data
-		td.User = app.Session.Get(r.Context(), "user").(data.User)
+	if user, ok := reqctx.User(r.Context()); ok { //pass the user to the template data
+		td.User = user
+		td.Permissions = app.userPermissions(r)
 	}
 
 	// execute the template, passing it data, if any
-	err = parsedTemplate.Execute(w, td)
+	err = writeTemplate(w, status, parsedTemplate, td)
 	if err != nil {
+		app.serverError(w, r, err)
 		return err
 	}
 
 	return nil
 }
 
+// maxPooledBuffer is the largest buffer kept for reuse, so that one huge
+// page doesn't keep its memory forever.
+const maxPooledBuffer = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// writeTemplate executes t into a buffer, and only sends it, with status,
+// once it has executed without an error. On an error nothing has been
+// written to w, so the caller can still send an error page instead.
+func writeTemplate(w http.ResponseWriter, status int, t *template.Template, td *TemplateData) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufferPool.Put(buf)
+		}
+	}()
+
+	if err := t.Execute(buf, td); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	// failing to write means the client has gone, there's no one to tell
+	_, _ = buf.WriteTo(w)
+	return nil
+}
+
 func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
 	// validate data
 	form := NewForm(r.PostForm)
+	form.Printer = app.printer(r)
 	form.Required("email", "password")
 
 	if !form.Valid() {
-		// redirect to the login page with error message
-		app.Session.Put(r.Context(), "error", "Invalid login credentials")
+		// redirect to the login page with error message, and the errors
+		// of each field
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid login credentials"))
+		app.stashForm(r, form)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -91,66 +181,202 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.DB.GetUserByEmail(email)
 	if err != nil {
-		// redirect to the login page with error message
-		app.Session.Put(r.Context(), "error", "Invalid login!")
+		app.audit(r, data.AuditLoginFailed, 0, map[string]any{"email": email, "reason": "unknown email"})
+		// redirect to the login page with error message, keeping the email
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid login!"))
+		app.stashForm(r, form)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	if !app.authenticate(r, user, password) {
-		app.Session.Put(r.Context(), "error", "Invalid login!")
+		app.audit(r, data.AuditLoginFailed, user.ID, map[string]any{"email": email, "reason": "wrong password"})
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid login!"))
+		app.stashForm(r, form)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// prevent fixation attack
-	_ = app.Session.RenewToken(r.Context())
+	if app.RequireVerified && !user.EmailVerified() {
+		app.audit(r, data.AuditLoginFailed, user.ID, map[string]any{"email": email, "reason": "email not verified"})
+		if err := app.sendVerificationEmail(user); err != nil {
+			log.Println(err)
+		}
+		app.Session.Put(r.Context(), "error", app.T(r, "Please verify your email address first, we've sent you a new link"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	remember := form.Has("remember")
+
+	// users with two-factor authentication enabled need to enter a code
+	// before they are logged in
+	if user.TOTPEnabled {
+		app.startSecondFactor(w, r, user, remember)
+		return
+	}
+
+	err = app.logUserIn(r, user, remember)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditLogin, user.ID, map[string]any{"remember": remember})
 
 	// redirect to some other page
-	app.Session.Put(r.Context(), "flash", "Successfully logged in!")
+	app.Session.Put(r.Context(), "flash", app.T(r, "Successfully logged in!"))
 	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
 }
 
+// authenticate checks the password of a user. While the plain text password
+// is at hand, hashes made with an outdated cost are upgraded.
 func (app *application) authenticate(r *http.Request, user *data.User, password string) bool {
 	if valid, err := user.PasswordMatches(password); err != nil || !valid {
 		return false
 	}
 
-	app.Session.Put(r.Context(), "user", user)
+	if app.Hasher.NeedsRehash(user.Password) {
+		if err := app.DB.ResetPassword(user.ID, password); err != nil {
+			log.Println("error rehashing password:", err)
+		}
+	}
+
 	return true
 }
 
+// startSecondFactor sends a user who has passed the first factor on to enter
+// their two-factor code.
+func (app *application) startSecondFactor(w http.ResponseWriter, r *http.Request, user *data.User, remember bool) {
+	_ = app.Session.RenewToken(r.Context())
+	app.Session.Put(r.Context(), "2fa_user_id", user.ID)
+	app.Session.Put(r.Context(), "2fa_remember", remember)
+	app.Session.Put(r.Context(), "2fa_expires", time.Now().Add(twoFactorTimeout).Unix())
+	http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+}
+
+// logUserIn puts an authenticated user in the session.
+func (app *application) logUserIn(r *http.Request, user *data.User, remember bool) error {
+	// prevent fixation attack
+	_ = app.Session.RenewToken(r.Context())
+
+	// keep track of the session, so that the user can see and revoke it;
+	// the user is only logged in once that worked, so that there is never a
+	// session which can't be revoked
+	if err := app.startUserSession(r, user, remember); err != nil {
+		return err
+	}
+
+	app.putSessionUser(r, *user)
+	return nil
+}
+
+// putSessionUser keeps user in the session. Sessions can be stored in the
+// database, so the password hash and the TOTP secret are left out.
+func (app *application) putSessionUser(r *http.Request, user data.User) {
+	user.Password = ""
+	user.TOTPSecret = ""
+	app.Session.Put(r.Context(), "user", user)
+}
+
+// Logout ends the current session.
+func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
+	if id := app.Session.GetString(r.Context(), "session_id"); id != "" {
+		if err := app.DB.DeleteUserSession(id); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if user, ok := reqctx.User(r.Context()); ok {
+		app.audit(r, data.AuditLogout, user.ID, nil)
+	}
+
+	app.endSession(w, r, app.T(r, "You have been logged out"))
+}
+
+// LogoutEverywhere ends every session of the logged in user, on every device.
+func (app *application) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	if user, ok := reqctx.User(r.Context()); ok {
+		if err := app.DB.DeleteUserSessions(user.ID, ""); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.audit(r, data.AuditLogoutEverywhere, user.ID, nil)
+	}
+
+	app.endSession(w, r, app.T(r, "You have been logged out everywhere"))
+}
+
+// endSession throws away all session data, including the user, and starts a
+// new session under a fresh token to carry the flash message. The language
+// the user chose isn't tied to their account, so it is kept.
+func (app *application) endSession(w http.ResponseWriter, r *http.Request, flash string) {
+	locale := app.Session.GetString(r.Context(), localeKey)
+
+	_ = app.Session.Destroy(r.Context())
+	_ = app.Session.RenewToken(r.Context())
+
+	if locale != "" {
+		app.Session.Put(r.Context(), localeKey, locale)
+	}
+	app.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 func (app *application) UploadProfilePic(w http.ResponseWriter, r *http.Request) {
-	// call a function that extracts a file from an upload (request)
-	files, err := app.UploadFiles(r, uploadPath)
+	err := r.ParseMultipartForm(maxUploadSize)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "the uploaded file is too big, should be less than 5MB")
+		return
+	}
+
+	var input struct {
+		Image *multipart.FileHeader `form:"image" validate:"required,maxsize=5MB,types=image/gif image/jpeg image/png"`
+	}
+
+	form := NewMultipartForm(r.MultipartForm)
+	form.Printer = app.printer(r)
+	if err := form.Bind(&input); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		app.stashForm(r, form)
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	// only the checked file is saved, whatever else was posted
+	file, err := saveUploadedFile(input.Image, uploadPath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		app.serverError(w, r, err)
 		return
 	}
 	// get the user from the session
-	user := app.Session.Get(r.Context(), "user").(data.User)
+	user, _ := reqctx.User(r.Context())
 
 	// create a variable of type data.UserImage
 	var i = data.UserImage{
 		UserID:   user.ID,
-		FileName: files[0].OriginalFileName,
+		FileName: file.OriginalFileName,
 	}
 
 	// insert the user's image into user_images table
 	_, err = app.DB.InsertUserImage(i)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		app.serverError(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditProfilePicChanged, user.ID, map[string]any{"file_name": i.FileName})
 
 	// refresh the sessional variable "user"
 	// update the User variable stored in the session --> to include the profile pic
 	updatedUser, err := app.DB.GetUser(user.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		app.serverError(w, r, err)
 		return
 	}
-	app.Session.Put(r.Context(), "user", updatedUser)
+	app.putSessionUser(r, *updatedUser)
 
 	// redirect back to the profile page
 	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
@@ -161,11 +387,15 @@ type UploadedFile struct {
 	FileSize         int64
 }
 
+// maxUploadSize is how much of an upload is kept in memory; the rest goes
+// to temporary files.
+const maxUploadSize = 1024 * 1024 * 5
+
 func (app *application) UploadFiles(r *http.Request, uploadDir string) ([]*UploadedFile, error) {
 	var uploadedFiles []*UploadedFile
 
 	// parse the form, so that we have access to the file
-	err := r.ParseMultipartForm(int64(1024 * 1024 * 5))
+	err := r.ParseMultipartForm(maxUploadSize)
 	if err != nil {
 		return nil, fmt.Errorf("the uploaded file is too big, should be less than 5MB")
 	}
@@ -175,41 +405,43 @@ func (app *application) UploadFiles(r *http.Request, uploadDir string) ([]*Uploa
 	// hdr --> header
 	for _, fHeaders := range r.MultipartForm.File { // extracts a file from the request and saves it to the file system
 		for _, hdr := range fHeaders {
-			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-				var uploadedFile UploadedFile
-				infile, err := hdr.Open() // opening the file included in the request
-				if err != nil {
-					return nil, err
-				}
-				defer infile.Close()
-
-				uploadedFile.OriginalFileName = hdr.Filename
-
-				var outfile *os.File
-				defer outfile.Close()
-
-				// copy the information in the request to our file system
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.OriginalFileName)); err != nil {
-					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
-					uploadedFile.FileSize = fileSize
-				}
-
-				uploadedFiles = append(uploadedFiles, &uploadedFile)
-
-				return uploadedFiles, nil
-			}(uploadedFiles)
+			uploadedFile, err := saveUploadedFile(hdr, uploadDir)
 			if err != nil {
 				return uploadedFiles, err
 			}
+			uploadedFiles = append(uploadedFiles, uploadedFile)
 		}
 	}
 
 	return uploadedFiles, nil
 }
 
+// saveUploadedFile copies an uploaded file to uploadDir, under the name it
+// was uploaded with.
+func saveUploadedFile(hdr *multipart.FileHeader, uploadDir string) (*UploadedFile, error) {
+	var uploadedFile UploadedFile
+	infile, err := hdr.Open() // opening the file included in the request
+	if err != nil {
+		return nil, err
+	}
+	defer infile.Close()
+
+	uploadedFile.OriginalFileName = filepath.Base(hdr.Filename)
+
+	// copy the information in the request to our file system
+	outfile, err := os.Create(filepath.Join(uploadDir, uploadedFile.OriginalFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer outfile.Close()
+
+	fileSize, err := io.Copy(outfile, infile)
+	if err != nil {
+		return nil, err
+	}
+	uploadedFile.FileSize = fileSize
+
+	return &uploadedFile, nil
+}
+
 // if you put a "defer" inside a for loop, you will have a resource leak
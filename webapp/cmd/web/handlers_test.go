@@ -18,6 +18,11 @@ import (
 	"sync"
 	"testing"
 	"webapp/pkg/data"
+	"webapp/pkg/passwords"
+	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/reqctx"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func Test_application_handlers(t *testing.T) {
@@ -121,24 +126,22 @@ func TestAppHome(t *testing.T) {
 	}
 }
 
-func TestApp_renderWithBadTemplate(t *testing.T) {
-	// set pathToTemplates to a location with a bad template
-	pathToTemplates = "./testdata/"
-
+func TestApp_renderWithMissingTemplate(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/", nil)
 	req = addContextAndSessionToRequest(req, app)
 	rr := httptest.NewRecorder()
 
-	err := app.render(rr, req, "bad.page.gohtml", &TemplateData{})
+	err := app.render(rr, req, "missing.page.gohtml", &TemplateData{})
 	if err == nil {
-		t.Error("expected error from bad template, but did not get one")
+		t.Error("expected error from missing template, but did not get one")
+	}
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 for a missing template, but got %d", rr.Code)
 	}
-
-	pathToTemplates = "./../../templates/"
 }
 
 func getCtx(req *http.Request) context.Context {
-	ctx := context.WithValue(req.Context(), contextUserKey, "unknown")
+	ctx := reqctx.WithIP(req.Context(), "unknown")
 	return ctx
 }
 
@@ -150,6 +153,62 @@ func addContextAndSessionToRequest(req *http.Request, app application) *http.Req
 	return req.WithContext(ctx)
 }
 
+// logIn puts user in the session of req, and returns req the way the
+// loadUser middleware passes it on to handlers.
+func logIn(req *http.Request, app application, user data.User) *http.Request {
+	app.Session.Put(req.Context(), "user", user)
+
+	app.loadUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	return req
+}
+
+func Test_app_putSessionUser(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	app.putSessionUser(req, data.User{ID: 2, Email: "2fa@example.com", Password: "hash", TOTPSecret: "secret", TOTPEnabled: true})
+
+	user, ok := app.Session.Get(req.Context(), "user").(data.User)
+	if !ok || user.ID != 2 || !user.TOTPEnabled {
+		t.Fatalf("expected the user in the session, but got %+v", user)
+	}
+	if user.Password != "" || user.TOTPSecret != "" {
+		t.Errorf("expected no secrets in the session, but got %+v", user)
+	}
+}
+
+// brokenSessionsRepo can't keep track of sessions.
+type brokenSessionsRepo struct {
+	dbrepo.TestDBRepo
+}
+
+func (m *brokenSessionsRepo) InsertUserSession(s data.UserSession) error {
+	return fmt.Errorf("connection refused")
+}
+
+func Test_app_Login_sessionNotTracked(t *testing.T) {
+	testApp := app
+	testApp.DB = &brokenSessionsRepo{}
+
+	postedData := url.Values{"email": {"admin@example.com"}, "password": {"secret"}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, testApp)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.Login).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, but got %d", rr.Code)
+	}
+	if testApp.Session.Exists(req.Context(), "user") {
+		t.Error("expected the user not to be logged in without a tracked session")
+	}
+}
+
 func Test_app_Login(t *testing.T) {
 	var tests = []struct {
 		name               string
@@ -166,6 +225,34 @@ func Test_app_Login(t *testing.T) {
 			expectedStatusCode: http.StatusSeeOther,
 			expectedLoc:        "/user/profile",
 		},
+		{
+			name: "email in another case",
+			postedData: url.Values{
+				"email":    {"Admin@Example.com"},
+				"password": {"secret"},
+			},
+			expectedStatusCode: http.StatusSeeOther,
+			expectedLoc:        "/user/profile",
+		},
+		{
+			name: "valid login with remember me",
+			postedData: url.Values{
+				"email":    {"admin@example.com"},
+				"password": {"secret"},
+				"remember": {"1"},
+			},
+			expectedStatusCode: http.StatusSeeOther,
+			expectedLoc:        "/user/profile",
+		},
+		{
+			name: "valid login with two-factor authentication",
+			postedData: url.Values{
+				"email":    {"2fa@example.com"},
+				"password": {"secret"},
+			},
+			expectedStatusCode: http.StatusSeeOther,
+			expectedLoc:        "/login/2fa",
+		},
 		{
 			name: "missing form data",
 			postedData: url.Values{
@@ -215,6 +302,17 @@ func Test_app_Login(t *testing.T) {
 		} else {
 			t.Errorf("%s: no location header set", e.name)
 		}
+
+		// a failed login fills in the email again, but never the password
+		if e.expectedLoc == "/" {
+			form := app.popForm(req)
+			if form.Data.Get("email") != e.postedData.Get("email") {
+				t.Errorf("%s: expected the email %q to be kept, but got %q", e.name, e.postedData.Get("email"), form.Data.Get("email"))
+			}
+			if form.Data.Has("password") {
+				t.Errorf("%s: the password was kept", e.name)
+			}
+		}
 	}
 }
 
@@ -289,7 +387,7 @@ func Test_app_UploadProfilePic(t *testing.T) {
 	filePath := "./testdata/img.png"
 
 	// specify a field name for the form
-	fieldName := "file"
+	fieldName := "image"
 
 	// create a bytes.Buffer to act as the request body
 	body := new(bytes.Buffer)
@@ -319,7 +417,7 @@ func Test_app_UploadProfilePic(t *testing.T) {
 	// building the test request
 	req := httptest.NewRequest(http.MethodPost, "/upload", body)
 	req = addContextAndSessionToRequest(req, app)
-	app.Session.Put(req.Context(), "user", data.User{ID: 1})
+	req = logIn(req, app, data.User{ID: 1})
 	req.Header.Add("Content-Type", mw.FormDataContentType())
 
 	// building the test response
@@ -336,3 +434,108 @@ func Test_app_UploadProfilePic(t *testing.T) {
 	// cleanup
 	_ = os.Remove("./testdata/uploads/img.png")
 }
+
+func Test_app_UploadProfilePic_invalid(t *testing.T) {
+	var tests = []struct {
+		name          string
+		fieldName     string
+		fileName      string
+		content       string
+		expectedError string
+	}{
+		{"no image", "file", "img.png", "", "This field cannot be blank"},
+		{"not an image", "image", "notes.png", "just some text", "Files must be one of these types: image/gif, image/jpeg, image/png"},
+	}
+
+	for _, e := range tests {
+		dir := useUploadDir(t)
+
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		w, err := mw.CreateFormFile(e.fieldName, e.fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(e.content))
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/user/upload-profile-pic", body)
+		req.Header.Add("Content-Type", mw.FormDataContentType())
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: 1})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.UploadProfilePic).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status 303, but got %d", e.name, rr.Code)
+		}
+		if msg := app.popForm(req).Errors.Get("image"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: expected nothing to be saved, but got %d files", e.name, len(entries))
+		}
+	}
+}
+
+func Test_app_Logout(t *testing.T) {
+	var tests = []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"logout", app.Logout},
+		{"logout everywhere", app.LogoutEverywhere},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/logout", nil)
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: 1})
+		app.Session.Put(req.Context(), "session_id", "current")
+		app.Session.Put(req.Context(), localeKey, "de")
+		oldToken := app.Session.Token(req.Context())
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if app.Session.Exists(req.Context(), "user") {
+			t.Errorf("%s: user is still in the session", e.name)
+		}
+
+		if app.Session.Token(req.Context()) == oldToken {
+			t.Errorf("%s: session token was not rotated", e.name)
+		}
+
+		if app.Session.GetString(req.Context(), "flash") == "" {
+			t.Errorf("%s: expected a flash message", e.name)
+		}
+
+		if locale := app.Session.GetString(req.Context(), localeKey); locale != "de" {
+			t.Errorf("%s: expected the chosen locale to be kept, but got %q", e.name, locale)
+		}
+	}
+}
+
+func Test_app_authenticate(t *testing.T) {
+	hash, _ := (&passwords.Bcrypt{Cost: bcrypt.MinCost}).Hash("secret")
+	user := &data.User{ID: 1, Password: hash}
+
+	testApp := app
+	testApp.Hasher = &passwords.Bcrypt{Cost: bcrypt.MinCost + 1}
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	req = addContextAndSessionToRequest(req, testApp)
+
+	if !testApp.authenticate(req, user, "secret") {
+		t.Error("expected correct password to authenticate, even when the hash needs upgrading")
+	}
+
+	if testApp.authenticate(req, user, "wrong") {
+		t.Error("expected wrong password not to authenticate")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"webapp/pkg/i18n"
+	"webapp/pkg/reqctx"
+)
+
+// localeKey is the session key of the locale a user chose, which wins over
+// the Accept-Language header of their browser.
+const localeKey = "locale"
+
+// locale picks the locale each request is answered in, and puts its
+// printer in the request context.
+func (app *application) locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := app.Session.GetString(r.Context(), localeKey)
+		if !app.I18n.Supported(locale) {
+			locale = app.I18n.Negotiate(r.Header.Get("Accept-Language"))
+		}
+
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", locale)
+
+		ctx := reqctx.WithPrinter(r.Context(), app.I18n.Printer(locale))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// printer returns the printer for the locale of r. Outside of the locale
+// middleware messages are left in English.
+func (app *application) printer(r *http.Request) *i18n.Printer {
+	p, _ := reqctx.Printer(r.Context())
+	return p
+}
+
+// T translates message into the locale of r, and formats it with args.
+func (app *application) T(r *http.Request, message string, args ...any) string {
+	return app.printer(r).T(message, args...)
+}
+
+// addLocale lets td translate its page into the locale of r, and offer the
+// other languages.
+func (app *application) addLocale(r *http.Request, td *TemplateData) {
+	td.printer = app.printer(r)
+	td.Locale = td.printer.Locale()
+	td.Languages = app.I18n.Languages()
+}
+
+// SetLocale stores the locale a user chose in their session, and sends them
+// back to the page they came from.
+func (app *application) SetLocale(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	locale := r.PostForm.Get("locale")
+	if !app.I18n.Supported(locale) {
+		app.errorResponse(w, r, http.StatusBadRequest, app.T(r, "Unknown language"))
+		return
+	}
+
+	app.Session.Put(r.Context(), localeKey, locale)
+	http.Redirect(w, r, localRedirect(r.Referer()), http.StatusSeeOther)
+}
+
+// localRedirect returns the path of referer, if it is a page of this site,
+// so that a forged Referer can't redirect anywhere else.
+func localRedirect(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Path == "" || u.Path[0] != '/' || (len(u.Path) > 1 && (u.Path[1] == '/' || u.Path[1] == '\\')) {
+		return "/"
+	}
+
+	target := u.Path
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return target
+}
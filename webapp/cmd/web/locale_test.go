@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
+)
+
+func Test_app_locale(t *testing.T) {
+	var tests = []struct {
+		name           string
+		sessionLocale  string
+		acceptLanguage string
+		expected       string
+	}{
+		{"default", "", "", "en"},
+		{"from the browser", "", "de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"chosen", "de", "en", "de"},
+		{"chosen but no longer supported", "xx", "de", "de"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", e.acceptLanguage)
+		}
+		if e.sessionLocale != "" {
+			app.Session.Put(req.Context(), localeKey, e.sessionLocale)
+		}
+
+		var locale string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := reqctx.Printer(r.Context())
+			if !ok {
+				t.Errorf("%s: no printer in the context", e.name)
+				return
+			}
+			locale = p.Locale()
+		})
+
+		rr := httptest.NewRecorder()
+		app.locale(next).ServeHTTP(rr, req)
+
+		if locale != e.expected {
+			t.Errorf("%s: expected locale %s but got %s", e.name, e.expected, locale)
+		}
+		if got := rr.Header().Get("Content-Language"); got != e.expected {
+			t.Errorf("%s: expected Content-Language %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func Test_app_SetLocale(t *testing.T) {
+	var tests = []struct {
+		name          string
+		locale        string
+		referer       string
+		expectedCode  int
+		expectedLoc   string
+		expectedStore string
+	}{
+		{"german", "de", "http://localhost/user/profile?tab=keys", http.StatusSeeOther, "/user/profile?tab=keys", "de"},
+		{"other site", "de", "https://example.com/phish", http.StatusSeeOther, "/phish", "de"},
+		{"no referer", "en", "", http.StatusSeeOther, "/", "en"},
+		{"unsupported", "xx", "", http.StatusBadRequest, "", ""},
+	}
+
+	for _, e := range tests {
+		body := url.Values{"locale": {e.locale}}.Encode()
+		req := httptest.NewRequest("POST", "/locale", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.referer != "" {
+			req.Header.Set("Referer", e.referer)
+		}
+		req = addContextAndSessionToRequest(req, app)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.SetLocale).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %q but got %q", e.name, e.expectedLoc, loc)
+		}
+		if locale := app.Session.GetString(req.Context(), localeKey); locale != e.expectedStore {
+			t.Errorf("%s: expected %q in the session but got %q", e.name, e.expectedStore, locale)
+		}
+	}
+}
+
+func Test_localRedirect(t *testing.T) {
+	var tests = []struct {
+		referer  string
+		expected string
+	}{
+		{"", "/"},
+		{"http://localhost/", "/"},
+		{"http://localhost", "/"},
+		{"/admin/audit?type=login", "/admin/audit?type=login"},
+		{"http://localhost//evil.example.com", "/"},
+		{"http://localhost/\\evil.example.com", "/"},
+		{"javascript:alert(1)", "/"},
+		{"%zz", "/"},
+	}
+
+	for _, e := range tests {
+		if got := localRedirect(e.referer); got != e.expected {
+			t.Errorf("%q: expected %q but got %q", e.referer, e.expected, got)
+		}
+	}
+}
+
+func Test_app_render_translated(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = req.WithContext(reqctx.WithPrinter(req.Context(), app.I18n.Printer("de")))
+	app.Session.Put(req.Context(), "flash", "Hallo")
+
+	rr := httptest.NewRecorder()
+	_ = app.render(rr, req, "home.page.gohtml", &TemplateData{})
+
+	body := rr.Body.String()
+	for _, expected := range []string{`<html lang="de">`, "<h1 class=\"mt-3\">Startseite</h1>", "Angemeldet bleiben", `value="Sprache ändern"`, "Hallo"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in the page", expected)
+		}
+	}
+}
+
+func Test_app_UserSessions_translatedDate(t *testing.T) {
+	req := httptest.NewRequest("GET", "/user/sessions", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1})
+	req = req.WithContext(reqctx.WithPrinter(req.Context(), app.I18n.Printer("de")))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.UserSessions).ServeHTTP(rr, req)
+
+	// the session was last seen now
+	if body := rr.Body.String(); !strings.Contains(body, "<td>gerade eben</td>") {
+		t.Error("expected the last seen time in German")
+	}
+}
@@ -3,37 +3,48 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 	"net"
 	"net/http"
+	"strings"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
 )
 
 type contextKey string
 
-const contextUserKey contextKey = "user_ip"
-
+// ipFromContext returns the IP address of the client, or "unknown" when the
+// request didn't go through addIPToContext.
 func (app *application) ipFromContext(ctx context.Context) string {
-	return ctx.Value(contextUserKey).(string)
+	ip, ok := reqctx.IP(ctx)
+	if !ok {
+		return "unknown"
+	}
+	return ip
 }
 
 func (app *application) addIPToContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var ctx = context.Background()
 		// get the ip (as accurately as possible)
-		ip, err := getIP(r)
+		ip, err := getIP(r, app.TrustedProxies)
 		if err != nil {
 			ip, _, _ = net.SplitHostPort(r.RemoteAddr)
 			if len(ip) == 0 {
 				ip = "unknown"
 			}
-			ctx = context.WithValue(r.Context(), contextUserKey, ip)
+			ctx = reqctx.WithIP(r.Context(), ip)
 		} else {
-			ctx = context.WithValue(r.Context(), contextUserKey, ip)
+			ctx = reqctx.WithIP(r.Context(), ip)
 		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func getIP(r *http.Request) (string, error) {
+// getIP returns the ip address of the client. Anyone can send an
+// X-Forwarded-For header, so it is only believed as far back as it was
+// added by trusted proxies.
+func getIP(r *http.Request, trusted trustedProxies) (string, error) {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return "unknown", err
@@ -44,22 +55,78 @@ func getIP(r *http.Request) (string, error) {
 		return "", fmt.Errorf("userip: %q is not IP:port", r.RemoteAddr)
 	}
 
-	forward := r.Header.Get("X-Forwarded-For")
-	if len(forward) > 0 {
-		ip = forward
+	// each proxy appends the address it got the request from, so walk back
+	// from the last one until an address isn't one of our proxies
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0 && trusted.trusts(userIP); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		userIP = hop
 	}
 
-	if len(ip) == 0 {
-		ip = "forward"
+	return userIP.String(), nil
+}
+
+// requestID gives every request an id, which is sent back in the
+// X-Request-ID header and can be used to find its log lines. An id set by a
+// proxy in front of us is kept, as long as it looks like one.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			var err error
+			if id, err = randomToken(8); err != nil {
+				id = "unknown"
+			}
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(reqctx.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID only allows short ids of letters, digits and dashes, so
+// that they are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
 	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// loadUser puts the user logged in through the session, and their
+// permissions, in the request context, so that they are looked up once per
+// request.
+func (app *application) loadUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := app.Session.Get(r.Context(), "user").(data.User)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := reqctx.WithUser(r.Context(), user)
+		permissions, err := app.DB.UserPermissions(user.ID)
+		if err != nil {
+			log.Println("error getting permissions:", err)
+		}
+		ctx = reqctx.WithPermissions(ctx, permissions)
 
-	return ip, nil
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 func (app *application) auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !app.Session.Exists(r.Context(), "user") {
-			app.Session.Put(r.Context(), "error", "Log in first!")
+		if _, ok := reqctx.User(r.Context()); !ok {
+			app.Session.Put(r.Context(), "error", app.T(r, "Log in first!"))
 			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 			return
 		}
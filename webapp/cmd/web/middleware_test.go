@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
 )
 
 func Test_application_addIPToContext(t *testing.T) {
@@ -25,15 +26,9 @@ func Test_application_addIPToContext(t *testing.T) {
 	// create a dummy handler that we'll use to check the context
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
 		// make sure that the value exists in the context
-		val := r.Context().Value(contextUserKey)
-		if val == nil {
-			t.Error(contextUserKey, "not present")
-		}
-
-		// make sure we got a string back
-		ip, ok := val.(string)
+		ip, ok := reqctx.IP(r.Context())
 		if !ok {
-			t.Error("not string")
+			t.Error("ip not present")
 		}
 		t.Log(ip)
 	})
@@ -60,12 +55,53 @@ func Test_application_addIPToContext(t *testing.T) {
 	}
 }
 
+func Test_getIP(t *testing.T) {
+	var trusted trustedProxies
+	_ = trusted.Set("10.0.0.0/8")
+
+	var tests = []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"no proxy", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"spoofed header", "192.0.2.1:1234", "198.51.100.7", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.1:1234", "198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"spoofed header behind a proxy", "10.0.0.1:1234", "203.0.113.5, 198.51.100.7", "198.51.100.7"},
+		{"trusted proxy without a header", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"garbage from a trusted proxy", "10.0.0.1:1234", "hello", "10.0.0.1"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		if e.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", e.forwarded)
+		}
+
+		ip, err := getIP(req, trusted)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+		}
+		if ip != e.expected {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expected, ip)
+		}
+	}
+}
+
 func Test_application_ipFromContext(t *testing.T) {
 	// get a context
 	ctx := context.Background()
 
+	// without an ip in the context
+	if ip := app.ipFromContext(ctx); ip != "unknown" {
+		t.Errorf("expected unknown for a missing ip, but got %s", ip)
+	}
+
 	// put something in the context
-	ctx = context.WithValue(ctx, contextUserKey, "whatever")
+	ctx = reqctx.WithIP(ctx, "whatever")
 
 	// call the function
 	ip := app.ipFromContext(ctx)
@@ -76,6 +112,84 @@ func Test_application_ipFromContext(t *testing.T) {
 	}
 }
 
+func Test_app_requestID(t *testing.T) {
+	var tests = []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"no header", "", ""},
+		{"id from proxy", "abc-123", "abc-123"},
+		{"unsafe id", "abc\nfake log line", ""},
+		{"too long", strings.Repeat("a", 65), ""},
+	}
+
+	for _, e := range tests {
+		var id string
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ = reqctx.RequestID(r.Context())
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.header != "" {
+			req.Header.Set("X-Request-ID", e.header)
+		}
+
+		rr := httptest.NewRecorder()
+		app.requestID(nextHandler).ServeHTTP(rr, req)
+
+		if id == "" || rr.Header().Get("X-Request-ID") != id {
+			t.Errorf("%s: expected request id %q to be sent back, but got %q", e.name, id, rr.Header().Get("X-Request-ID"))
+		}
+		if e.expected != "" && id != e.expected {
+			t.Errorf("%s: expected request id %s, but got %s", e.name, e.expected, id)
+		}
+		if e.expected == "" && id == e.header {
+			t.Errorf("%s: expected a new request id", e.name)
+		}
+	}
+}
+
+func Test_app_loadUser(t *testing.T) {
+	var tests = []struct {
+		name                string
+		user                *data.User
+		expectedPermissions int
+	}{
+		{"admin", &data.User{ID: 1}, 5},
+		{"no roles", &data.User{ID: 2}, 0},
+		{"not logged in", nil, 0},
+	}
+
+	for _, e := range tests {
+		var user data.User
+		var loaded, hasPermissions bool
+		var permissions []string
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, loaded = reqctx.User(r.Context())
+			permissions, hasPermissions = reqctx.Permissions(r.Context())
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.user != nil {
+			app.Session.Put(req.Context(), "user", *e.user)
+		}
+
+		app.loadUser(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+		if loaded != (e.user != nil) || hasPermissions != (e.user != nil) {
+			t.Errorf("%s: expected user loaded to be %t, but got %t", e.name, e.user != nil, loaded)
+		}
+		if e.user != nil && user.ID != e.user.ID {
+			t.Errorf("%s: expected user %d, but got %d", e.name, e.user.ID, user.ID)
+		}
+		if len(permissions) != e.expectedPermissions {
+			t.Errorf("%s: expected %d permissions, but got %v", e.name, e.expectedPermissions, permissions)
+		}
+	}
+}
+
 func Test_app_auth(t *testing.T) {
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
 
@@ -94,7 +208,7 @@ func Test_app_auth(t *testing.T) {
 		req := httptest.NewRequest("GET", "http://testing", nil)
 		req = addContextAndSessionToRequest(req, app)
 		if e.isAuth {
-			app.Session.Put(req.Context(), "user", data.User{ID: 1})
+			req = logIn(req, app, data.User{ID: 1})
 		}
 		rr := httptest.NewRecorder()
 		handlerToTest.ServeHTTP(rr, req)
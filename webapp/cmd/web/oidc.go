@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+	"webapp/pkg/repository"
+	"webapp/pkg/reqctx"
+)
+
+// errEmailTaken is returned when someone logs in with an identity whose
+// unverified email address belongs to an existing user.
+var errEmailTaken = fmt.Errorf("email address belongs to another user")
+
+// errUserDeleted is returned when someone logs in with an identity linked to
+// a user who is in the trash.
+var errUserDeleted = fmt.Errorf("identity belongs to a deleted user")
+
+// OIDCLogin sends the user to the identity provider to log in. A logged in
+// user can be sent to log in again, to confirm who they are for one of the
+// reauthPages named by the reauth parameter.
+func (app *application) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if app.OIDC == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	verifier, err := oidc.Verifier()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Session.Put(r.Context(), "oidc_state", state)
+	app.Session.Put(r.Context(), "oidc_nonce", nonce)
+	app.Session.Put(r.Context(), "oidc_verifier", verifier)
+
+	authURL := app.OIDC.AuthCodeURL(state, nonce, verifier)
+	reauth := r.URL.Query().Get("reauth")
+	if _, ok := reqctx.User(r.Context()); ok && reauthPages[reauth] {
+		app.Session.Put(r.Context(), "oidc_reauth", reauth)
+		authURL = app.OIDC.ReauthURL(state, nonce, verifier)
+	} else {
+		app.Session.Remove(r.Context(), "oidc_reauth")
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback is where the identity provider sends the user back to. The
+// user is logged in, or, when already logged in, the identity is linked to
+// their account, or confirms who they are.
+func (app *application) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if app.OIDC == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	state := app.Session.PopString(r.Context(), "oidc_state")
+	nonce := app.Session.PopString(r.Context(), "oidc_nonce")
+	verifier := app.Session.PopString(r.Context(), "oidc_verifier")
+	reauth := app.Session.PopString(r.Context(), "oidc_reauth")
+
+	q := r.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(q.Get("state"))) != 1 {
+		app.Session.Put(r.Context(), "error", app.T(r, "Login failed, please try again"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if q.Get("error") != "" {
+		app.Session.Put(r.Context(), "error", app.T(r, "Login with %s was cancelled", app.OIDCName))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	token, err := app.OIDC.Exchange(r.Context(), q.Get("code"), verifier)
+	if err != nil {
+		log.Println(err)
+		app.Session.Put(r.Context(), "error", app.T(r, "Login failed, please try again"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	claims, err := app.OIDC.VerifyIDToken(r.Context(), token.IDToken, nonce)
+	if err != nil {
+		log.Println(err)
+		app.Session.Put(r.Context(), "error", app.T(r, "Login failed, please try again"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if current, ok := reqctx.User(r.Context()); ok {
+		if reauth != "" {
+			app.reauthenticate(w, r, &current, claims, reauth)
+			return
+		}
+		app.linkIdentity(w, r, &current, claims)
+		return
+	}
+
+	user, err := app.userForIdentity(r, claims)
+	if err == errEmailTaken {
+		app.Session.Put(r.Context(), "error", app.T(r, "There is already an account for %s, log in with your password to link it", claims.Email))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err == errUserDeleted {
+		// the same as logging in to a deleted account with a password
+		app.audit(r, data.AuditLoginFailed, 0, map[string]any{"provider": app.OIDC.Issuer(), "reason": "deleted user"})
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid login!"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		app.startSecondFactor(w, r, user, false)
+		return
+	}
+
+	err = app.logUserIn(r, user, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditLogin, user.ID, map[string]any{"provider": app.OIDC.Issuer()})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Successfully logged in!"))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// userForIdentity returns the user an identity is linked to. Identities
+// which aren't linked yet are linked to the user with the same email
+// address, as long as the provider has verified it, or else to a new user.
+// Identities of users in the trash give errUserDeleted; they stay linked, in
+// case the user is restored.
+func (app *application) userForIdentity(r *http.Request, claims *oidc.Claims) (*data.User, error) {
+	identity, err := app.DB.GetUserIdentity(app.OIDC.Issuer(), claims.Subject)
+	if err == nil {
+		user, err := app.DB.GetUser(identity.UserID)
+		if err == sql.ErrNoRows {
+			return nil, errUserDeleted
+		}
+		return user, err
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, fmt.Errorf("identity %s has no email address", claims.Subject)
+	}
+
+	user, err := app.DB.GetUserByEmail(claims.Email)
+	if err == nil && !claims.EmailVerified {
+		return nil, errEmailTaken
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == sql.ErrNoRows {
+		user, err = app.newUserForIdentity(claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = app.DB.InsertUserIdentity(data.UserIdentity{
+		UserID:   user.ID,
+		Provider: app.OIDC.Issuer(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	app.audit(r, data.AuditIdentityLinked, user.ID, map[string]any{"provider": app.OIDC.Issuer()})
+
+	return user, nil
+}
+
+// newUserForIdentity creates a user for someone who first logs in with an
+// identity provider. They get a random password, which they can't know.
+func (app *application) newUserForIdentity(claims *oidc.Claims) (*data.User, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	user := data.User{
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+		Email:     claims.Email,
+		Password:  password,
+	}
+	if user.FirstName == "" {
+		user.FirstName = claims.Name
+	}
+
+	user.ID, err = app.DB.InsertUser(user)
+	if err == repository.ErrDuplicateEmail {
+		// the address belongs to someone in another case
+		return nil, errEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.EmailVerified {
+		if err := app.DB.VerifyEmail(user.ID, user.Email); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	return &user, nil
+}
+
+// linkIdentity links an identity to the logged in user.
+func (app *application) linkIdentity(w http.ResponseWriter, r *http.Request, user *data.User, claims *oidc.Claims) {
+	identity, err := app.DB.GetUserIdentity(app.OIDC.Issuer(), claims.Subject)
+	if err == nil {
+		if identity.UserID != user.ID {
+			app.Session.Put(r.Context(), "error", app.T(r, "This %s account is linked to another user", app.OIDCName))
+		} else {
+			app.Session.Put(r.Context(), "flash", app.T(r, "Your %s account is already linked", app.OIDCName))
+		}
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+	if err != sql.ErrNoRows {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_, err = app.DB.InsertUserIdentity(data.UserIdentity{
+		UserID:   user.ID,
+		Provider: app.OIDC.Issuer(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditIdentityLinked, user.ID, map[string]any{"provider": app.OIDC.Issuer()})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Your %s account is now linked, you can use it to log in", app.OIDCName))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
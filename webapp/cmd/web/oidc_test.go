@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+	"webapp/pkg/oidc/oidctest"
+	"webapp/pkg/repository/dbrepo"
+)
+
+// oidcTestApp returns a copy of app which logs in with a fake provider.
+func oidcTestApp(t *testing.T) (application, *oidctest.Provider) {
+	fake := oidctest.NewProvider()
+	t.Cleanup(fake.Close)
+
+	provider, err := oidc.Discover(context.Background(), oidc.Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  "http://example.com/login/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := app
+	testApp.OIDC = provider
+	testApp.OIDCName = "Fake"
+	return testApp, fake
+}
+
+// oidcLogin starts a login at target, lets the fake provider log the user
+// in, and returns the callback request, in the same session.
+func oidcLogin(t *testing.T, testApp application, fake *oidctest.Provider, user *data.User, target string) *http.Request {
+	req := httptest.NewRequest("GET", target, nil)
+	req = addContextAndSessionToRequest(req, testApp)
+	if user != nil {
+		req = logIn(req, testApp, *user)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.OIDCLogin).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected status 302, but got %d", rr.Code)
+	}
+	loc := rr.Header().Get("Location")
+	if !strings.HasPrefix(loc, fake.Issuer()+"/authorize?") || !strings.Contains(loc, "code_challenge_method=S256") {
+		t.Fatalf("unexpected authorization url %s", loc)
+	}
+
+	callback, err := fake.Authorize(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewRequest("GET", callback.String(), nil).WithContext(req.Context())
+}
+
+func Test_app_OIDCCallback(t *testing.T) {
+	var tests = []struct {
+		name          string
+		subject       string
+		email         string
+		emailVerified bool
+		loggedIn      *data.User
+		expectedLoc   string
+		expectedUser  int
+		expectedFlash string
+		expectedError string
+	}{
+		{"linked identity", "linked-subject", "admin@example.com", true, nil, "/user/profile", 1, "Successfully logged in!", ""},
+		{"new user", "new-subject", "someone@example.com", true, nil, "/user/profile", 2, "Successfully logged in!", ""},
+		{"existing verified email", "new-subject", "admin@example.com", true, nil, "/user/profile", 1, "Successfully logged in!", ""},
+		{"existing unverified email", "new-subject", "admin@example.com", false, nil, "/", 0, "", "There is already an account for admin@example.com, log in with your password to link it"},
+		{"two-factor user", "new-subject", "2fa@example.com", true, nil, "/login/2fa", 0, "", ""},
+		{"link to logged in user", "new-subject", "other@example.com", true, &data.User{ID: 1}, "/user/profile", 1, "Your Fake account is now linked, you can use it to log in", ""},
+		{"linked to another user", "linked-subject", "admin@example.com", true, &data.User{ID: 3}, "/user/profile", 3, "", "This Fake account is linked to another user"},
+	}
+
+	for _, e := range tests {
+		testApp, fake := oidcTestApp(t)
+		fake.User.Subject = e.subject
+		fake.User.Email = e.email
+		fake.User.EmailVerified = e.emailVerified
+
+		req := oidcLogin(t, testApp, fake, e.loggedIn, "/login/oidc")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.OIDCCallback).ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+
+		user, _ := testApp.Session.Get(req.Context(), "user").(data.User)
+		if user.ID != e.expectedUser {
+			t.Errorf("%s: expected user %d in the session, but got %d", e.name, e.expectedUser, user.ID)
+		}
+		if flash := testApp.Session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := testApp.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+// deletedUserRepo has the linked identity's user in the trash.
+type deletedUserRepo struct {
+	dbrepo.TestDBRepo
+	inserted bool
+}
+
+func (m *deletedUserRepo) GetUser(id int) (*data.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *deletedUserRepo) InsertUser(user data.User) (int, error) {
+	m.inserted = true
+	return m.TestDBRepo.InsertUser(user)
+}
+
+func Test_app_OIDCCallback_deletedUser(t *testing.T) {
+	testApp, fake := oidcTestApp(t)
+	repo := &deletedUserRepo{}
+	testApp.DB = repo
+	fake.User.Subject = "linked-subject"
+	fake.User.Email = "admin@example.com"
+	fake.User.EmailVerified = true
+
+	req := oidcLogin(t, testApp, fake, nil, "/login/oidc")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.OIDCCallback).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("expected location /, but got %s", loc)
+	}
+	if testApp.Session.Exists(req.Context(), "user") {
+		t.Error("expected a deleted user not to be logged in")
+	}
+	if msg := testApp.Session.GetString(req.Context(), "error"); msg != "Invalid login!" {
+		t.Errorf("unexpected error %q", msg)
+	}
+	if repo.inserted {
+		t.Error("expected no new user for the identity of a deleted one")
+	}
+}
+
+func Test_app_OIDCCallback_badState(t *testing.T) {
+	testApp, fake := oidcTestApp(t)
+	req := oidcLogin(t, testApp, fake, nil, "/login/oidc")
+
+	q := req.URL.Query()
+	q.Set("state", "forged")
+	req.URL.RawQuery = q.Encode()
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testApp.OIDCCallback).ServeHTTP(rr, req)
+
+	if testApp.Session.Exists(req.Context(), "user") {
+		t.Error("expected a forged state not to log anyone in")
+	}
+	if msg := testApp.Session.GetString(req.Context(), "error"); msg != "Login failed, please try again" {
+		t.Errorf("unexpected error %q", msg)
+	}
+}
+
+func Test_app_OIDCLogin_notConfigured(t *testing.T) {
+	for _, h := range []http.HandlerFunc{app.OIDCLogin, app.OIDCCallback} {
+		req := httptest.NewRequest("GET", "/login/oidc", nil)
+		req = addContextAndSessionToRequest(req, app)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404 without a provider, but got %d", rr.Code)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"webapp/pkg/reqctx"
+)
+
+// userPermissions returns the permissions of the logged in user, or the
+// user of the API key, which come from their roles. Permissions are looked
+// up once per request by loadUser and apiAuth, so that taking a role away
+// works straight away.
+func (app *application) userPermissions(r *http.Request) []string {
+	permissions, _ := reqctx.Permissions(r.Context())
+	return permissions
+}
+
+// hasPermission reports whether permission is one of permissions.
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// canManage reports whether the logged in user has every permission the
+// user with id has, so that nobody can act on a user more powerful than
+// them, eg support staff locking an admin out.
+func (app *application) canManage(r *http.Request, id int) (bool, error) {
+	theirs, err := app.DB.UserPermissions(id)
+	if err != nil {
+		return false, err
+	}
+
+	mine := app.userPermissions(r)
+	for _, p := range theirs {
+		if !hasPermission(mine, p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RequirePermission only lets through users with permission, eg
+// "users:delete", through one of their roles.
+func (app *application) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasPermission(app.userPermissions(r), permission) {
+				app.clientError(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
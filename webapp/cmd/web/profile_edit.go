@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+	"webapp/pkg/reqctx"
+)
+
+// EditProfile shows the forms to change the name, email address and
+// password of the logged in user.
+func (app *application) EditProfile(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+
+	// fill in what the user has now, unless they just tried to change it
+	form := app.popForm(r)
+	current := map[string]string{
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"email":      user.Email,
+	}
+	for field, value := range current {
+		if !form.Data.Has(field) {
+			form.Data.Set(field, value)
+		}
+	}
+
+	var td = make(map[string]any)
+	if app.OIDC != nil {
+		td["oidc"] = app.OIDCName
+	}
+	td["reauthenticated"] = app.recentlyReauthenticated(r)
+
+	_ = app.render(w, r, "profile-edit.page.gohtml", &TemplateData{Form: form, Data: td})
+}
+
+// PostEditProfile changes the name and email address of the logged in
+// user. A new email address has to be verified again.
+func (app *application) PostEditProfile(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		FirstName string `form:"first_name" validate:"required,max=255"`
+		LastName  string `form:"last_name" validate:"required,max=255"`
+		Email     string `form:"email" validate:"required,email,max=255"`
+	}
+
+	form := NewForm(r.PostForm)
+	form.Printer = app.printer(r)
+	if err := form.Bind(&input); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the user in the session may be out of date, so changes are made to
+	// the one in the database
+	sessionUser, _ := reqctx.User(r.Context())
+	user, err := app.DB.GetUser(sessionUser.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	emailChanged := input.Email != user.Email
+	if emailChanged && form.Errors.Get("email") == "" {
+		other, err := app.DB.GetUserByEmail(input.Email)
+		if err != nil && err != sql.ErrNoRows {
+			app.serverError(w, r, err)
+			return
+		}
+		form.Check(err == sql.ErrNoRows || other.ID == user.ID, "email", "There is already an account for this email address")
+	}
+
+	if !form.Valid() {
+		app.stashForm(r, form)
+		http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+		return
+	}
+
+	user.FirstName = input.FirstName
+	user.LastName = input.LastName
+	user.Email = input.Email
+	err = app.DB.UpdateUser(*user)
+	if err == repository.ErrDuplicateEmail {
+		// someone else took the address since it was checked, or has it in
+		// another case
+		form.Check(false, "email", "There is already an account for this email address")
+		app.stashForm(r, form)
+		http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditProfileUpdated, user.ID, map[string]any{"email_changed": emailChanged})
+
+	user, err = app.refreshSessionUser(r, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	flash := "Your profile has been updated"
+	if emailChanged {
+		if err := app.sendVerificationEmail(user); err != nil {
+			log.Println(err)
+		}
+		flash = "Your profile has been updated, we've sent a verification link to your new email address"
+	}
+	app.Session.Put(r.Context(), "flash", app.T(r, flash))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// ChangePassword changes the password of the logged in user, who has to
+// know their current one, or have just logged in with the identity provider
+// again.
+func (app *application) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Current string `form:"current_password"`
+		New     string `form:"new_password" validate:"required,nefield=Current"`
+		Confirm string `form:"confirm_password" validate:"required,eqfield=New"`
+	}
+
+	form := NewForm(r.PostForm)
+	form.Printer = app.printer(r)
+	if err := form.Bind(&input); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if input.New != "" {
+		form.Password("new_password", app.PasswordPolicy)
+	}
+
+	sessionUser, _ := reqctx.User(r.Context())
+	user, err := app.DB.GetUser(sessionUser.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	reauthenticated := app.recentlyReauthenticated(r)
+	if !reauthenticated {
+		form.Required("current_password")
+		if input.Current != "" {
+			valid, err := user.PasswordMatches(input.Current)
+			form.Check(err == nil && valid, "current_password", "This isn't your current password")
+		}
+	}
+
+	if !form.Valid() {
+		app.stashForm(r, form)
+		http.Redirect(w, r, "/user/profile/edit", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.DB.ResetPassword(user.ID, input.New); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditPasswordChanged, user.ID, map[string]any{"reauthenticated": reauthenticated})
+
+	// confirming who they are is good for one change
+	app.Session.Remove(r.Context(), "reauth_at")
+
+	if _, err := app.refreshSessionUser(r, user.ID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Your password has been changed"))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// refreshSessionUser loads a user from the database into the session, after
+// they changed, so that the session doesn't keep showing the old values.
+func (app *application) refreshSessionUser(r *http.Request, id int) (*data.User, error) {
+	user, err := app.DB.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	app.putSessionUser(r, *user)
+	return user, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/mailer"
+)
+
+func Test_app_EditProfile(t *testing.T) {
+	req := httptest.NewRequest("GET", "/user/profile/edit", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.EditProfile).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, but got %d", rr.Code)
+	}
+	for _, expected := range []string{`value="Admin"`, `value="User"`, `value="admin@example.com"`} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %s in the form", expected)
+		}
+	}
+
+	// what the user tried before wins over what they have now
+	form := NewForm(url.Values{"email": {"new@example.com"}})
+	form.Errors.Add("email", "There is already an account for this email address")
+	app.stashForm(req, form)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.EditProfile).ServeHTTP(rr, req)
+
+	for _, expected := range []string{`value="Admin"`, `value="new@example.com"`, "There is already an account for this email address"} {
+		if !strings.Contains(rr.Body.String(), expected) {
+			t.Errorf("expected %s in the form", expected)
+		}
+	}
+}
+
+func Test_app_PostEditProfile(t *testing.T) {
+	var tests = []struct {
+		name          string
+		postedData    url.Values
+		expectedLoc   string
+		expectedField string
+		expectedError string
+		expectedMail  bool
+	}{
+		{"same email", url.Values{"first_name": {"Two"}, "last_name": {"Factor"}, "email": {"2fa@example.com"}}, "/user/profile", "", "", false},
+		{"new email", url.Values{"first_name": {"Two"}, "last_name": {"Factor"}, "email": {"new@example.com"}}, "/user/profile", "", "", true},
+		{"email taken", url.Values{"first_name": {"Two"}, "last_name": {"Factor"}, "email": {"admin@example.com"}}, "/user/profile/edit", "email", "There is already an account for this email address", false},
+		{"email taken in another case", url.Values{"first_name": {"Two"}, "last_name": {"Factor"}, "email": {"Admin@Example.com"}}, "/user/profile/edit", "email", "There is already an account for this email address", false},
+		{"bad email", url.Values{"first_name": {"Two"}, "last_name": {"Factor"}, "email": {"two"}}, "/user/profile/edit", "email", "Enter a valid email address", false},
+		{"no first name", url.Values{"first_name": {""}, "last_name": {"Factor"}, "email": {"2fa@example.com"}}, "/user/profile/edit", "first_name", "This field cannot be blank", false},
+	}
+
+	for _, e := range tests {
+		mail := &mailer.MemoryMailer{}
+		testApp := app
+		testApp.Mailer = mail
+
+		req := httptest.NewRequest("POST", "/user/profile/edit", strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, testApp)
+		req = logIn(req, testApp, data.User{ID: 2, FirstName: "Old", Email: "2fa@example.com"})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.PostEditProfile).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status 303, but got %d", e.name, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+		if e.expectedField != "" {
+			form := testApp.popForm(req)
+			if msg := form.Errors.Get(e.expectedField); msg != e.expectedError {
+				t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+			}
+			continue
+		}
+
+		// the session has the user as they are in the database now
+		if user, _ := testApp.Session.Get(req.Context(), "user").(data.User); user.FirstName != "Two" {
+			t.Errorf("%s: expected the session user to be refreshed, but got %+v", e.name, user)
+		}
+		if sent := len(mail.Messages()) > 0; sent != e.expectedMail {
+			t.Errorf("%s: expected a verification email %t, but got %t", e.name, e.expectedMail, sent)
+		}
+	}
+}
+
+func Test_app_PostEditProfile_lookupError(t *testing.T) {
+	// an email which can't be looked up isn't taken to be free
+	postedData := url.Values{"first_name": {"Two"}, "last_name": {"Factor"}, "email": {"broken@example.com"}}
+	req := httptest.NewRequest("POST", "/user/profile/edit", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 2, Email: "2fa@example.com"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.PostEditProfile).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, but got %d", rr.Code)
+	}
+}
+
+func Test_app_ChangePassword(t *testing.T) {
+	var tests = []struct {
+		name          string
+		current       string
+		new           string
+		confirm       string
+		expectedField string
+		expectedError string
+	}{
+		{"valid", "secret", "correct horse battery", "correct horse battery", "", ""},
+		{"no current password", "", "correct horse battery", "correct horse battery", "current_password", "This field cannot be blank"},
+		{"wrong current password", "wrong", "correct horse battery", "correct horse battery", "current_password", "This isn't your current password"},
+		{"not confirmed", "secret", "correct horse battery", "correct horse", "confirm_password", "This doesn't match"},
+		{"unchanged", "secret", "secret", "secret", "new_password", "This has to be different"},
+		{"too short", "secret", "short", "short", "new_password", "Password must be at least 8 characters long"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{
+			"current_password": {e.current},
+			"new_password":     {e.new},
+			"confirm_password": {e.confirm},
+		}
+		req := httptest.NewRequest("POST", "/user/password", strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: 2})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.ChangePassword).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status 303, but got %d", e.name, rr.Code)
+		}
+
+		if e.expectedField == "" {
+			if loc := rr.Header().Get("Location"); loc != "/user/profile" {
+				t.Errorf("%s: expected location /user/profile, but got %s", e.name, loc)
+			}
+			if flash := app.Session.GetString(req.Context(), "flash"); flash != "Your password has been changed" {
+				t.Errorf("%s: unexpected flash %q", e.name, flash)
+			}
+			continue
+		}
+
+		form := app.popForm(req)
+		if msg := form.Errors.Get(e.expectedField); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+		for field := range postedData {
+			if form.Data.Has(field) {
+				t.Errorf("%s: %s was kept in the session", e.name, field)
+			}
+		}
+	}
+}
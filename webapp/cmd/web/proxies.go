@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// trustedProxies are the networks of the proxies in front of us, whose
+// X-Forwarded-For headers are believed. It implements flag.Value, so that
+// it can be set as a comma separated list of addresses and networks, eg
+// "10.0.0.0/8,192.0.2.1".
+type trustedProxies []*net.IPNet
+
+func (p *trustedProxies) String() string {
+	if p == nil {
+		return ""
+	}
+	var nets []string
+	for _, n := range *p {
+		nets = append(nets, n.String())
+	}
+	return strings.Join(nets, ",")
+}
+
+func (p *trustedProxies) Set(s string) error {
+	var nets trustedProxies
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			ip := net.ParseIP(field)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", field)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(field)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", field)
+		}
+		nets = append(nets, n)
+	}
+
+	*p = nets
+	return nil
+}
+
+// trusts reports whether ip is one of the trusted proxies.
+func (p trustedProxies) trusts(ip net.IP) bool {
+	for _, n := range p {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_trustedProxies_Set(t *testing.T) {
+	var tests = []struct {
+		name        string
+		value       string
+		trusted     []string
+		untrusted   []string
+		expectError bool
+	}{
+		{"none", "", nil, []string{"10.0.0.1"}, false},
+		{"network", "10.0.0.0/8", []string{"10.1.2.3"}, []string{"192.0.2.1"}, false},
+		{"addresses", "192.0.2.1, ::1", []string{"192.0.2.1", "::1"}, []string{"192.0.2.2"}, false},
+		{"not an address", "proxy.example.com", nil, nil, true},
+		{"bad network", "10.0.0.0/99", nil, nil, true},
+	}
+
+	for _, e := range tests {
+		var p trustedProxies
+		err := p.Set(e.value)
+
+		if e.expectError != (err != nil) {
+			t.Errorf("%s: expected an error %t, but got %v", e.name, e.expectError, err)
+		}
+		for _, ip := range e.trusted {
+			if !p.trusts(net.ParseIP(ip)) {
+				t.Errorf("%s: expected %s to be trusted", e.name, ip)
+			}
+		}
+		for _, ip := range e.untrusted {
+			if p.trusts(net.ParseIP(ip)) {
+				t.Errorf("%s: expected %s not to be trusted", e.name, ip)
+			}
+		}
+	}
+}
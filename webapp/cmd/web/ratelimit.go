@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/reqctx"
+)
+
+// rateLimit describes how many requests a route group accepts per window.
+// It implements flag.Value, so that it can be set as "requests/window", eg
+// "100/1m".
+type rateLimit struct {
+	Name     string
+	Requests int
+	Window   time.Duration
+}
+
+// rateLimits holds the limits for each rate limited route group.
+type rateLimits struct {
+	Default rateLimit
+	Login   rateLimit
+	Upload  rateLimit
+}
+
+func defaultRateLimits() rateLimits {
+	return rateLimits{
+		Default: rateLimit{Name: "default", Requests: 300, Window: time.Minute},
+		Login:   rateLimit{Name: "login", Requests: 10, Window: time.Minute},
+		Upload:  rateLimit{Name: "upload", Requests: 5, Window: time.Minute},
+	}
+}
+
+func (l *rateLimit) String() string {
+	if l == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+func (l *rateLimit) Set(s string) error {
+	requests, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return fmt.Errorf("rate limit %q should look like requests/window, eg 100/1m", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil {
+		return fmt.Errorf("invalid number of requests in rate limit %q", s)
+	}
+
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid window in rate limit %q", s)
+	}
+
+	l.Requests = n
+	l.Window = d
+	return nil
+}
+
+// rateLimit limits the number of requests a client can make to the routes
+// it wraps. Clients are identified by their user id when logged in, and by
+// their ip address otherwise. A limit with zero requests disables it.
+func (app *application) rateLimit(limit rateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit.Requests <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := limit.Name + ":" + app.rateLimitKey(r)
+			res, err := app.RateLimiter.Take(key, limit.Requests, limit.Window)
+			if err != nil {
+				// fail open: a broken backend shouldn't take the site down
+				log.Println("rate limiter:", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			resetIn := seconds(res.RetryAfter(time.Now()))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(resetIn))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(resetIn))
+				app.clientError(w, r, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the principal making a request.
+func (app *application) rateLimitKey(r *http.Request) string {
+	if user, ok := reqctx.User(r.Context()); ok {
+		return "user:" + strconv.Itoa(user.ID)
+	}
+	return "ip:" + app.ipFromContext(r.Context())
+}
+
+// seconds rounds d up to whole seconds, for headers.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
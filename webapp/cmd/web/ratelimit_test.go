@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/ratelimit"
+)
+
+func Test_rateLimit_Set(t *testing.T) {
+	var tests = []struct {
+		name             string
+		value            string
+		expectedRequests int
+		expectedWindow   time.Duration
+		expectError      bool
+	}{
+		{"valid", "100/1m", 100, time.Minute, false},
+		{"disabled", "0/1s", 0, time.Second, false},
+		{"missing window", "100", 0, 0, true},
+		{"bad requests", "many/1m", 0, 0, true},
+		{"bad window", "100/soon", 0, 0, true},
+	}
+
+	for _, e := range tests {
+		var l rateLimit
+		err := l.Set(e.value)
+
+		if e.expectError && err == nil {
+			t.Errorf("%s: expected an error, but did not get one", e.name)
+		}
+
+		if !e.expectError && err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+		}
+
+		if l.Requests != e.expectedRequests || l.Window != e.expectedWindow {
+			t.Errorf("%s: expected %d/%s, but got %d/%s", e.name, e.expectedRequests, e.expectedWindow, l.Requests, l.Window)
+		}
+	}
+}
+
+func Test_app_rateLimit(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name         string
+		user         int
+		expectedCode int
+	}{
+		{"first anonymous request", 0, http.StatusOK},
+		{"second anonymous request", 0, http.StatusOK},
+		{"anonymous over the limit", 0, http.StatusTooManyRequests},
+		{"logged in user has own limit", 1, http.StatusOK},
+	}
+
+	app := app
+	app.RateLimiter = ratelimit.NewMemoryStore()
+	handlerToTest := app.rateLimit(rateLimit{Name: "test", Requests: 2, Window: time.Minute})(nextHandler)
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "http://testing", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.user > 0 {
+			req = logIn(req, app, data.User{ID: e.user})
+		}
+
+		rr := httptest.NewRecorder()
+		handlerToTest.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if rr.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("%s: expected RateLimit-Limit header of 2, but got %q", e.name, rr.Header().Get("RateLimit-Limit"))
+		}
+
+		if e.expectedCode == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected a Retry-After header", e.name)
+		}
+	}
+}
+
+func Test_app_rateLimit_spoofedForwardedFor(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	app := app
+	app.RateLimiter = ratelimit.NewMemoryStore()
+	app.TrustedProxies = nil
+	handlerToTest := app.addIPToContext(app.rateLimit(rateLimit{Name: "test", Requests: 2, Window: time.Minute})(nextHandler))
+
+	// a new X-Forwarded-For on every request doesn't make a new client
+	for i, expectedCode := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		req = addContextAndSessionToRequest(req, app)
+
+		rr := httptest.NewRecorder()
+		handlerToTest.ServeHTTP(rr, req)
+
+		if rr.Code != expectedCode {
+			t.Errorf("request %d: expected status %d, but got %d", i+1, expectedCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_rateLimit_disabled(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handlerToTest := app.rateLimit(rateLimit{Name: "off"})(nextHandler)
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "http://testing", nil)
+		req = addContextAndSessionToRequest(req, app)
+		rr := httptest.NewRecorder()
+		handlerToTest.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 with rate limiting disabled, but got %d", rr.Code)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+)
+
+// reauthMaxAge is how long ago a user may have logged in with the identity
+// provider to confirm who they are, and how long that confirmation lasts.
+const reauthMaxAge = 5 * time.Minute
+
+// reauthPages are the named routes a user can confirm who they are for with
+// the identity provider, instead of with their password, which users who
+// signed up with the provider don't know.
+var reauthPages = map[string]bool{
+	"account.delete": true,
+	"profile.edit":   true,
+}
+
+// reauthenticate accepts a fresh login with the identity provider as proof
+// that the logged in user is who they say they are, if the identity is
+// linked to them, and sends them back to page.
+func (app *application) reauthenticate(w http.ResponseWriter, r *http.Request, user *data.User, claims *oidc.Claims, page string) {
+	identity, err := app.DB.GetUserIdentity(app.OIDC.Issuer(), claims.Subject)
+	if err != nil && err != sql.ErrNoRows {
+		app.serverError(w, r, err)
+		return
+	}
+
+	switch {
+	case err == sql.ErrNoRows || identity.UserID != user.ID:
+		app.Session.Put(r.Context(), "error", app.T(r, "This %s account isn't linked to yours", app.OIDCName))
+	case time.Since(time.Unix(claims.AuthTime, 0)) > reauthMaxAge:
+		// the provider let them through on a session it already had with
+		// them, which proves nothing about who is at the keyboard now
+		app.Session.Put(r.Context(), "error", app.T(r, "%s didn't ask you to log in again, please try again", app.OIDCName))
+	default:
+		app.Session.Put(r.Context(), "reauth_at", time.Now().Unix())
+		app.Session.Put(r.Context(), "flash", app.T(r, "Thanks, you've confirmed it's you"))
+	}
+
+	http.Redirect(w, r, routePattern(page), http.StatusSeeOther)
+}
+
+// recentlyReauthenticated reports whether the logged in user has confirmed
+// who they are with the identity provider in the last reauthMaxAge.
+func (app *application) recentlyReauthenticated(r *http.Request) bool {
+	at := app.Session.GetInt64(r.Context(), "reauth_at")
+	return at != 0 && time.Since(time.Unix(at, 0)) < reauthMaxAge
+}
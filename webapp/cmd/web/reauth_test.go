@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+)
+
+func Test_app_OIDCLogin_reauth(t *testing.T) {
+	var tests = []struct {
+		name           string
+		target         string
+		loggedIn       bool
+		expectedReauth string
+	}{
+		{"logged in", "/login/oidc?reauth=account.delete", true, "account.delete"},
+		{"not logged in", "/login/oidc?reauth=account.delete", false, ""},
+		{"unknown page", "/login/oidc?reauth=admin.users", true, ""},
+	}
+
+	for _, e := range tests {
+		testApp, fake := oidcTestApp(t)
+
+		req := httptest.NewRequest("GET", e.target, nil)
+		req = addContextAndSessionToRequest(req, testApp)
+		if e.loggedIn {
+			req = logIn(req, testApp, data.User{ID: 1})
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.OIDCLogin).ServeHTTP(rr, req)
+
+		if reauth := testApp.Session.GetString(req.Context(), "oidc_reauth"); reauth != e.expectedReauth {
+			t.Errorf("%s: expected reauth %q, but got %q", e.name, e.expectedReauth, reauth)
+		}
+
+		// the provider has to make the user log in again, not wave them
+		// through on a session it has with them
+		loc := rr.Header().Get("Location")
+		if !strings.HasPrefix(loc, fake.Issuer()+"/authorize?") {
+			t.Errorf("%s: unexpected authorization url %s", e.name, loc)
+		}
+		if prompted := strings.Contains(loc, "prompt=login"); prompted != (e.expectedReauth != "") {
+			t.Errorf("%s: expected prompt=login in the url to be %t, but got %s", e.name, e.expectedReauth != "", loc)
+		}
+	}
+}
+
+func Test_app_OIDCCallback_reauth(t *testing.T) {
+	var tests = []struct {
+		name          string
+		subject       string
+		authAge       time.Duration
+		loggedIn      int
+		expectedError string
+	}{
+		{"linked identity", "linked-subject", 0, 1, ""},
+		{"not linked", "new-subject", 0, 1, "This Fake account isn't linked to yours"},
+		{"linked to another user", "linked-subject", 0, 3, "This Fake account isn't linked to yours"},
+		{"old login", "linked-subject", time.Hour, 1, "Fake didn't ask you to log in again, please try again"},
+	}
+
+	for _, e := range tests {
+		testApp, fake := oidcTestApp(t)
+		fake.User.Subject = e.subject
+		fake.User.Email = "admin@example.com"
+		fake.User.EmailVerified = true
+		authAge := e.authAge
+		fake.Claims = func(claims map[string]any) {
+			claims["auth_time"] = time.Now().Add(-authAge).Unix()
+		}
+
+		req := oidcLogin(t, testApp, fake, &data.User{ID: e.loggedIn}, "/login/oidc?reauth=account.delete")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.OIDCCallback).ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != "/user/delete" {
+			t.Errorf("%s: expected location /user/delete, but got %s", e.name, loc)
+		}
+		if msg := testApp.Session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+		if reauthenticated := testApp.recentlyReauthenticated(req); reauthenticated != (e.expectedError == "") {
+			t.Errorf("%s: expected reauthenticated to be %t, but got %t", e.name, e.expectedError == "", reauthenticated)
+		}
+		// confirming who you are doesn't link anything
+		if flash := testApp.Session.GetString(req.Context(), "flash"); strings.Contains(flash, "linked") {
+			t.Errorf("%s: unexpected flash %q", e.name, flash)
+		}
+	}
+}
+
+// Test_app_PostDeleteAccount_oidcOnly deletes the account of a user who
+// signed up with the identity provider, and so doesn't know their password.
+func Test_app_PostDeleteAccount_oidcOnly(t *testing.T) {
+	var tests = []struct {
+		name          string
+		reauthAge     time.Duration
+		expectedLoc   string
+		expectedError string
+	}{
+		{"reauthenticated", 0, "/", ""},
+		{"reauthenticated too long ago", 10 * time.Minute, "/user/delete", "This field cannot be blank"},
+	}
+
+	for _, e := range tests {
+		useUploadDir(t)
+		testApp, fake := oidcTestApp(t)
+		fake.User.Subject = "linked-subject"
+		fake.User.Email = "admin@example.com"
+		fake.User.EmailVerified = true
+
+		req := oidcLogin(t, testApp, fake, &data.User{ID: 1}, "/login/oidc?reauth=account.delete")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.OIDCCallback).ServeHTTP(rr, req)
+		if e.reauthAge > 0 {
+			testApp.Session.Put(req.Context(), "reauth_at", time.Now().Add(-e.reauthAge).Unix())
+		}
+
+		postedData := url.Values{"password": {""}}
+		post := httptest.NewRequest("POST", "/user/delete", strings.NewReader(postedData.Encode())).WithContext(req.Context())
+		post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(testApp.PostDeleteAccount).ServeHTTP(rr, post)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+		if e.expectedError != "" {
+			form := testApp.popForm(post)
+			if msg := form.Errors.Get("password"); msg != e.expectedError {
+				t.Errorf("%s: expected error %q, but got %q", e.name, e.expectedError, msg)
+			}
+			continue
+		}
+		if flash := testApp.Session.GetString(post.Context(), "flash"); flash != "Your account has been deleted" {
+			t.Errorf("%s: unexpected flash %q", e.name, flash)
+		}
+	}
+}
+
+func Test_app_ChangePassword_reauthenticated(t *testing.T) {
+	postedData := url.Values{
+		"new_password":     {"correct horse battery"},
+		"confirm_password": {"correct horse battery"},
+	}
+	req := httptest.NewRequest("POST", "/user/password", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1})
+	app.Session.Put(req.Context(), "reauth_at", time.Now().Unix())
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.ChangePassword).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/user/profile" {
+		t.Errorf("expected location /user/profile, but got %s", loc)
+	}
+	if flash := app.Session.GetString(req.Context(), "flash"); flash != "Your password has been changed" {
+		t.Errorf("unexpected flash %q", flash)
+	}
+	// it's good for one change
+	if app.recentlyReauthenticated(req) {
+		t.Error("expected the confirmation to be used up")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"webapp/pkg/reqctx"
+)
+
+// wantsJSON reports whether an error should be sent as JSON rather than as
+// an HTML page: for the API, and for clients which prefer JSON.
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// errorResponse sends an error with status, as JSON or as the error page.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	requestID, _ := reqctx.RequestID(r.Context())
+
+	if wantsJSON(r) {
+		resp := map[string]string{"error": message}
+		if requestID != "" {
+			resp["request_id"] = requestID
+		}
+		app.writeJSON(w, status, resp)
+		return
+	}
+
+	parsedTemplate, err := app.Templates.get("error.page.gohtml")
+	if err != nil {
+		app.logError(r, err)
+		http.Error(w, message, status)
+		return
+	}
+
+	// the error page leaves flash messages in the session, they belong to
+	// the next page that works
+	td := &TemplateData{
+		IP:    app.ipFromContext(r.Context()),
+		Nonce: app.nonceFromContext(r.Context()),
+		Data: map[string]any{
+			"title":     app.T(r, http.StatusText(status)),
+			"message":   app.T(r, message),
+			"requestID": requestID,
+		},
+	}
+	app.addLocale(r, td)
+	// a logged in user has a session, and needs its CSRF token for the
+	// log out buttons
+	if user, ok := reqctx.User(r.Context()); ok {
+		td.User = user
+		td.CSRFToken = app.csrfToken(r)
+	}
+
+	if err := writeTemplate(w, status, parsedTemplate, td); err != nil {
+		app.logError(r, err)
+		http.Error(w, message, status)
+	}
+}
+
+// clientError sends status, with its standard text as the message.
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorResponse(w, r, status, http.StatusText(status))
+}
+
+// serverError sends the status that err maps to. Errors which are our
+// fault are logged, and their details are never shown to the client.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	status := statusForError(err)
+	if status >= http.StatusInternalServerError {
+		app.logError(r, err)
+	}
+	app.clientError(w, r, status)
+}
+
+// statusForError maps errors from the layers below to a response status.
+func statusForError(err error) int {
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// logError logs err together with the id of the request, which the client
+// is shown.
+func (app *application) logError(r *http.Request, err error) {
+	requestID, _ := reqctx.RequestID(r.Context())
+	log.Printf("[%s] %s %s: %s", requestID, r.Method, r.URL.Path, err)
+}
+
+// notFound is the handler for routes which don't exist.
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusNotFound, "The page you're looking for doesn't exist.")
+}
+
+// methodNotAllowed is the handler for routes which exist, but not with the
+// method of the request.
+func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusMethodNotAllowed)
+}
+
+// recoverer turns a panic in a handler into a logged server error, instead
+// of a dropped connection.
+func (app *application) recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				// the client went away, let the server deal with it
+				panic(rvr)
+			}
+			app.serverError(w, r, fmt.Errorf("panic: %v\n%s", rvr, debug.Stack()))
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
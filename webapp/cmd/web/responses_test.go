@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"webapp/pkg/reqctx"
+)
+
+func Test_app_errorResponse(t *testing.T) {
+	var tests = []struct {
+		name                string
+		url                 string
+		accept              string
+		expectedContentType string
+	}{
+		{"browser", "/user/profile", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"no accept header", "/user/profile", "", "text/html; charset=utf-8"},
+		{"json client", "/user/profile", "application/json", "application/json"},
+		{"api", "/api/me", "", "application/json"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+		req = addContextAndSessionToRequest(req, app)
+		req = req.WithContext(reqctx.WithRequestID(req.Context(), "req-1"))
+
+		rr := httptest.NewRecorder()
+		app.errorResponse(rr, req, http.StatusTeapot, "no coffee here")
+
+		if rr.Code != http.StatusTeapot {
+			t.Errorf("%s: expected status %d, but got %d", e.name, http.StatusTeapot, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, but got %s", e.name, e.expectedContentType, ct)
+		}
+		if !strings.Contains(rr.Body.String(), "no coffee here") || !strings.Contains(rr.Body.String(), "req-1") {
+			t.Errorf("%s: expected the message and request id in %s", e.name, rr.Body.String())
+		}
+	}
+}
+
+func Test_app_serverError(t *testing.T) {
+	var tests = []struct {
+		name         string
+		err          error
+		expectedCode int
+	}{
+		{"not found", sql.ErrNoRows, http.StatusNotFound},
+		{"anything else", fmt.Errorf("connection refused to db.internal:5432"), http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		rr := httptest.NewRecorder()
+		app.serverError(rr, req, e.err)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		var resp map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid JSON: %s", e.name, err)
+		}
+		if resp["error"] != http.StatusText(e.expectedCode) {
+			t.Errorf("%s: expected only the status text, but got %q", e.name, resp["error"])
+		}
+	}
+}
+
+func Test_app_notFoundAndMethodNotAllowed(t *testing.T) {
+	var tests = []struct {
+		name                string
+		method              string
+		url                 string
+		accept              string
+		expectedCode        int
+		expectedContentType string
+	}{
+		{"unknown page", "GET", "/nowhere", "", http.StatusNotFound, "text/html; charset=utf-8"},
+		{"json client", "GET", "/nowhere", "application/json", http.StatusNotFound, "application/json"},
+		{"wrong method", "DELETE", "/", "", http.StatusMethodNotAllowed, "text/html; charset=utf-8"},
+		{"post to an unknown page", "POST", "/nowhere", "", http.StatusNotFound, "text/html; charset=utf-8"},
+		{"get of a form", "GET", "/logout", "", http.StatusMethodNotAllowed, "text/html; charset=utf-8"},
+	}
+
+	routes := app.routes()
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, e.url, nil)
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, but got %s", e.name, e.expectedContentType, ct)
+		}
+		if rr.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s: expected a request id", e.name)
+		}
+	}
+}
+
+func Test_app_recoverer(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	})
+
+	req := httptest.NewRequest("GET", "/user/profile", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	app.recoverer(panicking).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500 after a panic, but got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "something went wrong") {
+		t.Error("the panic should not be shown to the client")
+	}
+
+	// aborted requests are left to the server
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	defer func() {
+		if rvr := recover(); rvr != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to be panicked again, but got %v", rvr)
+		}
+	}()
+	app.recoverer(aborting).ServeHTTP(httptest.NewRecorder(), req)
+}
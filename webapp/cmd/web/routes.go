@@ -2,31 +2,136 @@ package main
 
 import (
 	"net/http"
+	"webapp/pkg/data"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 )
 
+// namedRoutes are the paths of every route, by name. Routes are registered,
+// and templates link to them with url, by name, so that a route can move
+// without hunting down every link to it.
+var namedRoutes = map[string]string{
+	"home":                     "/",
+	"login":                    "/login",
+	"login.2fa":                "/login/2fa",
+	"login.oidc":               "/login/oidc",
+	"login.oidc.callback":      "/login/oidc/callback",
+	"logout":                   "/logout",
+	"logout.all":               "/logout/all",
+	"locale":                   "/locale",
+	"verify-email":             "/verify-email",
+	"profile":                  "/user/profile",
+	"profile.pic":              "/user/upload-profile-pic",
+	"profile.edit":             "/user/profile/edit",
+	"profile.password":         "/user/password",
+	"account.export":           "/user/export",
+	"account.delete":           "/user/delete",
+	"sessions":                 "/user/sessions",
+	"sessions.revoke":          "/user/sessions/{id}/revoke",
+	"sessions.revoke-others":   "/user/sessions/revoke-others",
+	"2fa":                      "/user/2fa",
+	"verify-email.resend":      "/user/verify-email",
+	"api-keys":                 "/user/api-keys",
+	"api-keys.revoke":          "/user/api-keys/{id}/revoke",
+	"admin.users":              "/admin/users",
+	"admin.users.delete":       "/admin/users/{id}/delete",
+	"admin.users.restore":      "/admin/users/{id}/restore",
+	"admin.trash":              "/admin/users/trash",
+	"admin.users.reset-2fa":    "/admin/users/{id}/reset-2fa",
+	"admin.users.roles":        "/admin/users/{id}/roles",
+	"admin.users.roles.revoke": "/admin/users/{id}/roles/{role}/revoke",
+	"admin.audit":              "/admin/audit",
+	"api.me":                   "/api/me",
+	"api.audit":                "/api/audit",
+}
+
+// routePattern returns the path of a named route. Names are fixed in the
+// code, so an unknown one is a bug, and panics.
+func routePattern(name string) string {
+	pattern, ok := namedRoutes[name]
+	if !ok {
+		panic("no route named " + name)
+	}
+	return pattern
+}
+
 func (app *application) routes() http.Handler {
 	mux := chi.NewRouter()
+	mux.NotFound(app.notFound)
+	mux.MethodNotAllowed(app.methodNotAllowed)
 
 	// register middleware
-	mux.Use(middleware.Recoverer)
+	mux.Use(app.requestID)
+	mux.Use(app.securityHeaders)
+	mux.Use(app.recoverer)
 	mux.Use(app.addIPToContext)
 	mux.Use(app.Session.LoadAndSave)
+	mux.Use(app.trackSession)
+	mux.Use(app.loadUser)
+	mux.Use(app.locale)
+	mux.Use(app.rateLimit(app.RateLimits.Default))
 
-	// register routes
-	mux.Get("/", app.Home)
-	mux.Post("/login", app.Login)
+	// register routes; route middleware, such as the CSRF check, runs in
+	// groups rather than subrouters, so that only requests which found a
+	// route get to it, and the rest are answered with 404 or 405
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.csrf)
+
+		mux.Get(routePattern("home"), app.Home)
+		mux.With(app.rateLimit(app.RateLimits.Login)).Post(routePattern("login"), app.Login)
+		mux.Get(routePattern("login.2fa"), app.LoginTwoFactor)
+		mux.With(app.rateLimit(app.RateLimits.Login)).Post(routePattern("login.2fa"), app.PostLoginTwoFactor)
+		mux.Post(routePattern("logout"), app.Logout)
+		mux.Post(routePattern("logout.all"), app.LogoutEverywhere)
+		mux.Post(routePattern("locale"), app.SetLocale)
+		mux.Get(routePattern("verify-email"), app.VerifyEmail)
+		mux.With(app.rateLimit(app.RateLimits.Login)).Get(routePattern("login.oidc"), app.OIDCLogin)
+		mux.With(app.rateLimit(app.RateLimits.Login)).Get(routePattern("login.oidc.callback"), app.OIDCCallback)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.auth)
+			mux.Get(routePattern("profile"), app.Profile)
+			mux.Get(routePattern("profile.edit"), app.EditProfile)
+			mux.Post(routePattern("profile.edit"), app.PostEditProfile)
+			mux.With(app.rateLimit(app.RateLimits.Login)).Post(routePattern("profile.password"), app.ChangePassword)
+			mux.Get(routePattern("account.export"), app.ExportData)
+			mux.Get(routePattern("account.delete"), app.DeleteAccount)
+			mux.With(app.rateLimit(app.RateLimits.Login)).Post(routePattern("account.delete"), app.PostDeleteAccount)
+			mux.With(app.rateLimit(app.RateLimits.Upload)).Post(routePattern("profile.pic"), app.UploadProfilePic)
+			mux.Get(routePattern("sessions"), app.UserSessions)
+			mux.Post(routePattern("sessions.revoke-others"), app.RevokeOtherUserSessions)
+			mux.Post(routePattern("sessions.revoke"), app.RevokeUserSession)
+			mux.Get(routePattern("2fa"), app.TwoFactorSetup)
+			mux.Post(routePattern("2fa"), app.PostTwoFactorSetup)
+			mux.With(app.rateLimit(app.RateLimits.Login)).Post(routePattern("verify-email.resend"), app.ResendVerificationEmail)
+			mux.Post(routePattern("api-keys"), app.CreateAPIKey)
+			mux.Post(routePattern("api-keys.revoke"), app.RevokeAPIKey)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.auth)
+			mux.With(app.RequirePermission(data.PermUsersRead)).Get(routePattern("admin.users"), app.AdminUsers)
+			mux.With(app.RequirePermission(data.PermUsersDelete)).Post(routePattern("admin.users.delete"), app.AdminDeleteUser)
+			mux.With(app.RequirePermission(data.PermUsersDelete)).Get(routePattern("admin.trash"), app.AdminTrash)
+			mux.With(app.RequirePermission(data.PermUsersDelete)).Post(routePattern("admin.users.restore"), app.AdminRestoreUser)
+			mux.With(app.RequirePermission(data.PermUsersReset2FA)).Post(routePattern("admin.users.reset-2fa"), app.AdminResetTwoFactor)
+			mux.With(app.RequirePermission(data.PermRolesManage)).Post(routePattern("admin.users.roles"), app.AdminAssignRole)
+			mux.With(app.RequirePermission(data.PermRolesManage)).Post(routePattern("admin.users.roles.revoke"), app.AdminRevokeRole)
+			mux.With(app.RequirePermission(data.PermAuditRead)).Get(routePattern("admin.audit"), app.AdminAudit)
+		})
+	})
 
-	mux.Route("/user", func(mux chi.Router) {
-		mux.Use(app.auth)
-		mux.Get("/profile", app.Profile)
-		mux.Post("/upload-profile-pic", app.UploadProfilePic)
+	// the API authenticates with a Bearer key rather than the session
+	// cookie, which other sites can't make a browser send, so it needs no
+	// CSRF token
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.apiAuth)
+		mux.With(app.requireScope(data.ScopeProfileRead)).Get(routePattern("api.me"), app.APIMe)
+		mux.With(app.requireScope(data.ScopeAuditRead), app.RequirePermission(data.PermAuditRead)).Get(routePattern("api.audit"), app.APIAudit)
 	})
 
 	// static assets
-	fileServer := http.FileServer(http.Dir("./static/"))
+	fileServer := http.FileServer(http.Dir(staticPath))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	return mux
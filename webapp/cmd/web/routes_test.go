@@ -15,7 +15,39 @@ func Test_application_routes(t *testing.T) {
 	}{
 		{"/", "GET"},
 		{"/login", "POST"},
+		{"/login/2fa", "GET"},
+		{"/login/2fa", "POST"},
+		{"/logout", "POST"},
+		{"/logout/all", "POST"},
+		{"/locale", "POST"},
 		{"/user/profile", "GET"},
+		{"/user/profile/edit", "GET"},
+		{"/user/profile/edit", "POST"},
+		{"/user/password", "POST"},
+		{"/user/export", "GET"},
+		{"/user/delete", "GET"},
+		{"/user/delete", "POST"},
+		{"/user/sessions", "GET"},
+		{"/user/sessions/revoke-others", "POST"},
+		{"/user/sessions/{id}/revoke", "POST"},
+		{"/user/2fa", "GET"},
+		{"/user/2fa", "POST"},
+		{"/admin/users", "GET"},
+		{"/admin/users/{id}/reset-2fa", "POST"},
+		{"/admin/users/{id}/delete", "POST"},
+		{"/admin/users/trash", "GET"},
+		{"/admin/users/{id}/restore", "POST"},
+		{"/admin/users/{id}/roles", "POST"},
+		{"/admin/users/{id}/roles/{role}/revoke", "POST"},
+		{"/user/api-keys", "POST"},
+		{"/user/api-keys/{id}/revoke", "POST"},
+		{"/api/me", "GET"},
+		{"/api/audit", "GET"},
+		{"/admin/audit", "GET"},
+		{"/verify-email", "GET"},
+		{"/login/oidc", "GET"},
+		{"/login/oidc/callback", "GET"},
+		{"/user/verify-email", "POST"},
 		{"/static/*", "GET"},
 	}
 
@@ -42,4 +74,13 @@ func routeExists(testRoute, testMethod string, chiRoutes chi.Routes) bool {
 	})
 
 	return found
-}
\ No newline at end of file
+}
+func Test_namedRoutes(t *testing.T) {
+	chiRoutes := app.routes().(chi.Routes)
+
+	for name, pattern := range namedRoutes {
+		if !routeExists(pattern, "GET", chiRoutes) && !routeExists(pattern, "POST", chiRoutes) {
+			t.Errorf("named route %s points to %s, which is not registered", name, pattern)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func Test_app_securityHeaders_allRoutes(t *testing.T) {
+	mux := app.routes()
+
+	expected := []string{
+		"Content-Security-Policy",
+		"Strict-Transport-Security",
+		"X-Content-Type-Options",
+		"X-Frame-Options",
+		"Referrer-Policy",
+		"Permissions-Policy",
+	}
+
+	_ = chi.Walk(mux.(chi.Routes), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// fill in url parameters and wildcards
+		path := strings.ReplaceAll(route, "/*", "/x")
+		for strings.Contains(path, "{") {
+			start := strings.Index(path, "{")
+			end := strings.Index(path, "}")
+			path = path[:start] + "1" + path[end+1:]
+		}
+
+		req := httptest.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		for _, header := range expected {
+			if rr.Header().Get(header) == "" {
+				t.Errorf("%s %s: missing %s header", method, route, header)
+			}
+		}
+
+		return nil
+	})
+}
+
+func Test_app_securityHeaders_nonce(t *testing.T) {
+	var nonce string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = app.nonceFromContext(r.Context())
+	})
+
+	rr := httptest.NewRecorder()
+	app.securityHeaders(nextHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if nonce == "" {
+		t.Fatal("no nonce in the request context")
+	}
+
+	if !strings.Contains(rr.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("nonce %s missing from policy %s", nonce, rr.Header().Get("Content-Security-Policy"))
+	}
+
+	first := nonce
+	app.securityHeaders(nextHandler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if nonce == first {
+		t.Error("nonce was reused for a second request")
+	}
+}
+
+func Test_app_securityHeaders_disabled(t *testing.T) {
+	testApp := app
+	testApp.SecurityHeaders = securityHeaders{}
+
+	rr := httptest.NewRecorder()
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	testApp.securityHeaders(nextHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	for _, header := range []string{"Content-Security-Policy", "Strict-Transport-Security", "X-Frame-Options"} {
+		if rr.Header().Get(header) != "" {
+			t.Errorf("expected %s to be left out, but got %q", header, rr.Header().Get(header))
+		}
+	}
+
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("X-Content-Type-Options should always be sent")
+	}
+}
+
+func TestHome_nonceInTemplate(t *testing.T) {
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	policy := rr.Header().Get("Content-Security-Policy")
+	start := strings.Index(policy, "'nonce-") + len("'nonce-")
+	nonce := policy[start : start+strings.Index(policy[start:], "'")]
+
+	if !strings.Contains(rr.Body.String(), `nonce="`+nonce+`"`) {
+		t.Errorf("expected nonce %s in the page", nonce)
+	}
+}
@@ -1,19 +1,75 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
+	"webapp/pkg/sessionstore"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
 )
 
+// sessionCleanupInterval is how often expired sessions are removed from
+// persistent session stores.
+const sessionCleanupInterval = 5 * time.Minute
 
-func getSession() *scs.SessionManager {
+// sessionLifetimes controls how long a logged in session lasts.
+type sessionLifetimes struct {
+	// Absolute is the lifetime of a session when "remember me" is unchecked.
+	Absolute time.Duration
+	// Remember is the lifetime of a session when "remember me" is checked.
+	Remember time.Duration
+	// Idle logs users out after this long without a request.
+	Idle time.Duration
+}
+
+func defaultSessionLifetimes() sessionLifetimes {
+	return sessionLifetimes{
+		Absolute: 24 * time.Hour,
+		Remember: 30 * 24 * time.Hour,
+		Idle:     2 * time.Hour,
+	}
+}
+
+// lifetime returns the absolute lifetime of a session.
+func (l sessionLifetimes) lifetime(remember bool) time.Duration {
+	if remember {
+		return l.Remember
+	}
+	return l.Absolute
+}
+
+func getSession(store scs.Store, lifetimes sessionLifetimes) *scs.SessionManager {
 	session := scs.New()
-	session.Lifetime = 24 * time.Hour
-	session.Cookie.Persist = true
+	session.Store = store
+	// scs has a single lifetime, so it uses the longest one; shorter
+	// sessions are expired by trackSession.
+	session.Lifetime = lifetimes.Remember
+	if lifetimes.Absolute > session.Lifetime {
+		session.Lifetime = lifetimes.Absolute
+	}
+	session.IdleTimeout = lifetimes.Idle
+	// only sessions with "remember me" checked outlive the browser
+	session.Cookie.Persist = false
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = true
 
 	return session
-}
\ No newline at end of file
+}
+
+// sessionStore returns the session store selected with the -session-store
+// flag: "memory" (the default), "postgres" or "file".
+func (app *application) sessionStore(conn *sql.DB) (scs.Store, error) {
+	switch app.SessionStore {
+	case "", "memory":
+		return memstore.New(), nil
+	case "postgres":
+		return sessionstore.NewPostgresStore(conn, sessionCleanupInterval), nil
+	case "file":
+		return sessionstore.NewFileStore(app.SessionDir, sessionCleanupInterval)
+	default:
+		return nil, fmt.Errorf("unknown session store %q", app.SessionStore)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/sessionstore"
+
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+func Test_app_sessionStore(t *testing.T) {
+	var tests = []struct {
+		name        string
+		store       string
+		expectError bool
+	}{
+		{"default", "", false},
+		{"memory", "memory", false},
+		{"file", "file", false},
+		{"unknown", "redis", true},
+	}
+
+	for _, e := range tests {
+		testApp := application{SessionStore: e.store, SessionDir: t.TempDir()}
+
+		store, err := testApp.sessionStore(nil)
+		if e.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error, but did not get one", e.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+		}
+
+		switch s := store.(type) {
+		case *memstore.MemStore:
+		case *sessionstore.FileStore:
+			s.StopCleanup()
+		default:
+			t.Errorf("%s: unexpected store type %T", e.name, store)
+		}
+	}
+}
+
+func Test_sessionSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first run of the application logs a user in
+	store, err := sessionstore.NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := application{Session: getSession(store, defaultSessionLifetimes())}
+
+	login := first.Session.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first.Session.Put(r.Context(), "user", data.User{ID: 1, Email: "admin@example.com"})
+	}))
+
+	rr := httptest.NewRecorder()
+	login.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie set")
+	}
+
+	// the second run only shares the session directory with the first
+	store, err = sessionstore.NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := application{Session: getSession(store, defaultSessionLifetimes())}
+
+	var user data.User
+	var ok bool
+	profile := second.Session.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok = second.Session.Get(r.Context(), "user").(data.User)
+	}))
+
+	req := httptest.NewRequest("GET", "/user/profile", nil)
+	req.AddCookie(cookies[0])
+	profile.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !ok || user.Email != "admin@example.com" {
+		t.Errorf("expected the session to survive a restart, but got user %+v", user)
+	}
+}
@@ -1,18 +1,49 @@
 package main
 
 import (
+	"encoding/gob"
+	"log"
 	"os"
 	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/mailer"
+	"webapp/pkg/passwords"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/tokens"
+	"webapp/templates"
+
+	"github.com/alexedwards/scs/v2/memstore"
 )
 
 var app application
 
 func TestMain(m *testing.M) {
-	pathToTemplates = "./../../templates/"
+	gob.Register(data.User{})
+	gob.Register(stashedForm{})
+	staticPath = "./../../static"
+	templateCache, err := newTemplateCache(templates.FS, templateFuncs(os.DirFS(staticPath)), false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Templates = templateCache
+
+	app.I18n, err = i18n.New()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	app.Session = getSession()
+	app.Lifetimes = defaultSessionLifetimes()
+	app.Session = getSession(memstore.New(), app.Lifetimes)
 	app.DB = &dbrepo.TestDBRepo{}
+	app.RateLimiter = ratelimit.NewMemoryStore()
+	app.RateLimits = defaultRateLimits()
+	app.SecurityHeaders = defaultSecurityHeaders()
+	app.Hasher = passwords.NewArgon2id()
+	app.PasswordPolicy = passwords.DefaultPolicy()
+	app.Mailer = &mailer.MemoryMailer{}
+	app.Tokens = tokens.NewSigner([]byte("a test key of at least 32 bytes!"))
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// templateFuncs are the functions every template can use. Functions which
+// depend on the request, like csrfField, take the template data.
+func templateFuncs(static fs.FS) template.FuncMap {
+	assets := newAssetVersions(static)
+
+	return template.FuncMap{
+		"humanDate":     humanDate,
+		"pluralize":     pluralize,
+		"truncate":      truncate,
+		"url":           routeURL,
+		"asset":         assets.url,
+		"csrfField":     csrfField,
+		"hasPermission": func(td *TemplateData, permission string) bool { return td.Can(permission) },
+		"formValue":     formValue,
+		"submitted":     submitted,
+		"invalid":       invalid,
+		"fieldError":    fieldError,
+		"T":             func(td *TemplateData, message string, args ...any) string { return td.printer.T(message, args...) },
+	}
+}
+
+// humanDate shows recent times relative to now, eg "5 minutes ago", and
+// other times as a date, in the language of the page. The layout of the
+// date is a message too, so that each language can write dates its own way.
+func humanDate(td *TemplateData, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	since := time.Since(t)
+	switch {
+	case since < 0 || since >= 24*time.Hour:
+		return t.Local().Format(td.printer.T("2 Jan 2006 at 15:04"))
+	case since < time.Minute:
+		return td.printer.T("just now")
+	case since < time.Hour:
+		return pluralize(td, int(since/time.Minute), "minute ago", "minutes ago")
+	default:
+		return pluralize(td, int(since/time.Hour), "hour ago", "hours ago")
+	}
+}
+
+// pluralize returns n with the singular or plural form of a word, eg
+// "1 key" or "3 keys", in the language of the page. The messages
+// translated are "%d " and the word, eg "%d keys".
+func pluralize(td *TemplateData, n int, singular, plural string) string {
+	if n == 1 {
+		return td.printer.T("%d "+singular, n)
+	}
+	return td.printer.T("%d "+plural, n)
+}
+
+// truncate shortens s to at most n characters, ending with an ellipsis
+// when anything was cut off.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// routeURL builds the path of a named route, filling in its parameters
+// from name, value pairs, eg url "api-keys.revoke" "id" 7.
+func routeURL(name string, pairs ...any) (string, error) {
+	pattern, ok := namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("url: no route named %s", name)
+	}
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("url: %s needs name, value pairs", name)
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		param := fmt.Sprintf("{%v}", pairs[i])
+		if !strings.Contains(pattern, param) {
+			return "", fmt.Errorf("url: route %s has no parameter %v", name, pairs[i])
+		}
+		pattern = strings.ReplaceAll(pattern, param, url.PathEscape(fmt.Sprint(pairs[i+1])))
+	}
+
+	if strings.Contains(pattern, "{") {
+		return "", fmt.Errorf("url: missing parameters for %s", pattern)
+	}
+	return pattern, nil
+}
+
+// csrfField is the hidden form field carrying the CSRF token, which every
+// form posting to us needs.
+func csrfField(td *TemplateData) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(td.CSRFToken) + `">`)
+}
+
+// formValue is the value the user entered in a field of the form, so that
+// a form which failed is filled in again.
+func formValue(td *TemplateData, field string) string {
+	if td.Form == nil {
+		return ""
+	}
+	return td.Form.Data.Get(field)
+}
+
+// submitted reports whether value was one of the values submitted for a
+// field, to check checkboxes and select options again.
+func submitted(td *TemplateData, field, value string) bool {
+	if td.Form == nil {
+		return false
+	}
+	for _, v := range td.Form.Data[field] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// invalid is the Bootstrap class marking an input with an error.
+func invalid(td *TemplateData, field string) string {
+	if td.Form == nil || td.Form.Errors.Get(field) == "" {
+		return ""
+	}
+	return "is-invalid"
+}
+
+// fieldError shows the error of a field, under an input marked invalid.
+func fieldError(td *TemplateData, field string) template.HTML {
+	if td.Form == nil {
+		return ""
+	}
+	msg := td.Form.Errors.Get(field)
+	if msg == "" {
+		return ""
+	}
+	return template.HTML(`<div class="invalid-feedback">` + template.HTMLEscapeString(msg) + `</div>`)
+}
+
+// assetVersions adds a hash of their content to the URLs of static files,
+// so that they can be cached for a long time and are still fetched again
+// when they change.
+type assetVersions struct {
+	fsys fs.FS
+
+	mu       sync.Mutex
+	versions map[string]assetVersion
+}
+
+type assetVersion struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+func newAssetVersions(fsys fs.FS) *assetVersions {
+	return &assetVersions{fsys: fsys, versions: make(map[string]assetVersion)}
+}
+
+// url returns the URL of a static file, eg "img/car.jpg", with a version.
+// Files which can't be read get a URL without a version.
+func (a *assetVersions) url(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	u := "/static/" + name
+
+	info, err := fs.Stat(a.fsys, name)
+	if err != nil {
+		return u
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	v, ok := a.versions[name]
+	if !ok || !v.modTime.Equal(info.ModTime()) || v.size != info.Size() {
+		content, err := fs.ReadFile(a.fsys, name)
+		if err != nil {
+			return u
+		}
+		sum := sha256.Sum256(content)
+		v = assetVersion{modTime: info.ModTime(), size: info.Size(), hash: hex.EncodeToString(sum[:4])}
+		a.versions[name] = v
+	}
+
+	return u + "?v=" + v.hash
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_humanDate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		locale   string
+		t        time.Time
+		expected string
+	}{
+		{"zero", "en", time.Time{}, ""},
+		{"seconds ago", "en", time.Now().Add(-10 * time.Second), "just now"},
+		{"a minute ago", "en", time.Now().Add(-time.Minute - time.Second), "1 minute ago"},
+		{"minutes ago", "en", time.Now().Add(-5*time.Minute - time.Second), "5 minutes ago"},
+		{"hours ago", "en", time.Now().Add(-3*time.Hour - time.Second), "3 hours ago"},
+		{"long ago", "en", time.Date(2022, 3, 4, 12, 30, 0, 0, time.Local), "4 Mar 2022 at 12:30"},
+		{"future", "en", time.Date(2099, 3, 4, 12, 30, 0, 0, time.Local), "4 Mar 2099 at 12:30"},
+		{"german seconds ago", "de", time.Now().Add(-10 * time.Second), "gerade eben"},
+		{"german minutes ago", "de", time.Now().Add(-5*time.Minute - time.Second), "vor 5 Minuten"},
+		{"german hour ago", "de", time.Now().Add(-time.Hour - time.Second), "vor 1 Stunde"},
+		{"german long ago", "de", time.Date(2022, 3, 4, 12, 30, 0, 0, time.Local), "4.3.2022 um 12:30"},
+	}
+
+	for _, e := range tests {
+		td := &TemplateData{printer: app.I18n.Printer(e.locale)}
+		if got := humanDate(td, e.t); got != e.expected {
+			t.Errorf("%s: expected %q, but got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func Test_pluralize(t *testing.T) {
+	var tests = []struct {
+		locale   string
+		n        int
+		expected string
+	}{
+		{"en", 0, "0 keys"},
+		{"en", 1, "1 key"},
+		{"en", 2, "2 keys"},
+		{"de", 1, "1 Schlüssel"},
+		{"de", 2, "2 Schlüssel"},
+	}
+
+	for _, e := range tests {
+		td := &TemplateData{printer: app.I18n.Printer(e.locale)}
+		if got := pluralize(td, e.n, "key", "keys"); got != e.expected {
+			t.Errorf("%s %d: expected %q, but got %q", e.locale, e.n, e.expected, got)
+		}
+	}
+}
+
+func Test_truncate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		s        string
+		n        int
+		expected string
+	}{
+		{"short", "Firefox", 10, "Firefox"},
+		{"exact", "Firefox", 7, "Firefox"},
+		{"long", "Mozilla Firefox", 8, "Mozilla…"},
+		{"multi byte", "héllo wörld", 5, "héll…"},
+		{"nothing", "Firefox", 0, ""},
+	}
+
+	for _, e := range tests {
+		if got := truncate(e.s, e.n); got != e.expected {
+			t.Errorf("%s: expected %q, but got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func Test_routeURL(t *testing.T) {
+	var tests = []struct {
+		name        string
+		route       string
+		pairs       []any
+		expected    string
+		expectError bool
+	}{
+		{"no parameters", "profile", nil, "/user/profile", false},
+		{"one parameter", "api-keys.revoke", []any{"id", 7}, "/user/api-keys/7/revoke", false},
+		{"two parameters", "admin.users.roles.revoke", []any{"id", 2, "role", "support"}, "/admin/users/2/roles/support/revoke", false},
+		{"escaped", "sessions.revoke", []any{"id", "a/b"}, "/user/sessions/a%2Fb/revoke", false},
+		{"unknown route", "rockets", nil, "", true},
+		{"missing parameter", "api-keys.revoke", nil, "", true},
+		{"unknown parameter", "api-keys.revoke", []any{"key", 7}, "", true},
+		{"odd pairs", "api-keys.revoke", []any{"id"}, "", true},
+	}
+
+	for _, e := range tests {
+		got, err := routeURL(e.route, e.pairs...)
+		if e.expectError && err == nil {
+			t.Errorf("%s: expected an error, but got %s", e.name, got)
+		}
+		if !e.expectError && (err != nil || got != e.expected) {
+			t.Errorf("%s: expected %s, but got %s (%v)", e.name, e.expected, got, err)
+		}
+	}
+}
+
+func Test_assetVersions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.css")
+	if err := os.WriteFile(file, []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assets := newAssetVersions(os.DirFS(dir))
+
+	first := assets.url("app.css")
+	if !strings.HasPrefix(first, "/static/app.css?v=") {
+		t.Errorf("expected a versioned url, but got %s", first)
+	}
+	if again := assets.url("/app.css"); again != first {
+		t.Errorf("expected the same version for unchanged content, but got %s and %s", first, again)
+	}
+
+	_ = os.WriteFile(file, []byte("body { color: red }"), 0644)
+	_ = os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if changed := assets.url("app.css"); changed == first {
+		t.Errorf("expected a new version after the file changed, but got %s", changed)
+	}
+
+	if missing := assets.url("missing.js"); missing != "/static/missing.js" {
+		t.Errorf("expected a missing file without a version, but got %s", missing)
+	}
+	if outside := assets.url("../secret.txt"); outside != "/static/secret.txt" {
+		t.Errorf("expected the path to stay inside the static directory, but got %s", outside)
+	}
+}
+
+func Test_csrfField(t *testing.T) {
+	field := string(csrfField(&TemplateData{CSRFToken: `a"b`}))
+
+	if !strings.Contains(field, `name="csrf_token"`) || !strings.Contains(field, `value="a&#34;b"`) {
+		t.Errorf("unexpected csrf field %s", field)
+	}
+}
+
+func Test_formHelpers(t *testing.T) {
+	form := NewForm(url.Values{"email": {"jack@example.com"}, "scopes": {"a", "b"}})
+	form.Errors.Add("email", `Not <valid>`)
+	td := &TemplateData{Form: form}
+
+	if got := formValue(td, "email"); got != "jack@example.com" {
+		t.Errorf("unexpected value %q", got)
+	}
+	if !submitted(td, "scopes", "b") || submitted(td, "scopes", "c") {
+		t.Error("unexpected submitted values")
+	}
+	if got := invalid(td, "email"); got != "is-invalid" {
+		t.Errorf("expected email to be invalid but got %q", got)
+	}
+	if got := invalid(td, "scopes"); got != "" {
+		t.Errorf("expected scopes to be valid but got %q", got)
+	}
+	if got := string(fieldError(td, "email")); got != `<div class="invalid-feedback">Not &lt;valid&gt;</div>` {
+		t.Errorf("unexpected field error %s", got)
+	}
+	if got := fieldError(td, "scopes"); got != "" {
+		t.Errorf("expected no field error but got %s", got)
+	}
+
+	// pages rendered without a form
+	empty := &TemplateData{}
+	if formValue(empty, "email") != "" || submitted(empty, "email", "") || invalid(empty, "email") != "" || fieldError(empty, "email") != "" {
+		t.Error("expected helpers to work without a form")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"sync"
+	"time"
+)
+
+// baseLayout, and the partials, are parsed together with every page.
+const (
+	baseLayout = "base.layout.gohtml"
+	partials   = "partials/*.gohtml"
+)
+
+// templateCache holds every page template, parsed once with the base
+// layout, keyed by the file name of the page.
+type templateCache struct {
+	fsys  fs.FS
+	funcs template.FuncMap
+	// reload parses the templates again when a file in fsys changes; for
+	// development, with fsys on disk.
+	reload bool
+
+	mu      sync.RWMutex
+	pages   map[string]*template.Template
+	modTime time.Time
+}
+
+// newTemplateCache parses all the pages in fsys, and fails on the first
+// template with an error, so that a broken template stops the server from
+// starting rather than failing requests.
+func newTemplateCache(fsys fs.FS, funcs template.FuncMap, reload bool) (*templateCache, error) {
+	c := &templateCache{fsys: fsys, funcs: funcs, reload: reload}
+
+	modTime, err := c.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	c.pages, err = parsePages(fsys, funcs)
+	if err != nil {
+		return nil, err
+	}
+	c.modTime = modTime
+
+	return c, nil
+}
+
+// parsePages parses each *.page.gohtml in fsys together with the base
+// layout and the partials, with funcs available to all of them.
+func parsePages(fsys fs.FS, funcs template.FuncMap) (map[string]*template.Template, error) {
+	names, err := fs.Glob(fsys, "*.page.gohtml")
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{baseLayout}
+	if matches, _ := fs.Glob(fsys, partials); len(matches) > 0 {
+		patterns = append(patterns, partials)
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		t, err := template.New(name).Funcs(funcs).ParseFS(fsys, append([]string{name}, patterns...)...)
+		if err != nil {
+			return nil, err
+		}
+		pages[name] = t
+	}
+
+	return pages, nil
+}
+
+// lastModified returns the newest modification time of the templates in
+// the cache's file system. Embedded files don't have one.
+func (c *templateCache) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	names, err := fs.Glob(c.fsys, "*.gohtml")
+	if err != nil {
+		return latest, err
+	}
+	partialNames, _ := fs.Glob(c.fsys, partials)
+	names = append(names, partialNames...)
+	for _, name := range names {
+		info, err := fs.Stat(c.fsys, name)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// get returns the template of a page. When reloading, the templates are
+// parsed again first if any of them changed since they were last parsed.
+func (c *templateCache) get(name string) (*template.Template, error) {
+	if c.reload {
+		if err := c.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	t, ok := c.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %s doesn't exist", name)
+	}
+	return t, nil
+}
+
+func (c *templateCache) reloadIfChanged() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	changed := modTime.After(c.modTime)
+	c.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	pages, err := parsePages(c.fsys, c.funcs)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.pages = pages
+	c.modTime = modTime
+	c.mu.Unlock()
+	log.Println("reloaded templates")
+
+	return nil
+}
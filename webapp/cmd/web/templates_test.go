@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"webapp/templates"
+)
+
+func Test_newTemplateCache(t *testing.T) {
+	c, err := newTemplateCache(templates.FS, templateFuncs(os.DirFS(staticPath)), false)
+	if err != nil {
+		t.Fatalf("embedded templates don't parse: %s", err)
+	}
+	if _, err := c.get("home.page.gohtml"); err != nil {
+		t.Errorf("expected the home page in the cache: %s", err)
+	}
+	if _, err := c.get("base.layout.gohtml"); err == nil {
+		t.Error("expected the layout not to be a page")
+	}
+
+	// a broken template stops the cache from being built at all
+	if _, err := newTemplateCache(os.DirFS("./testdata"), templateFuncs(os.DirFS(staticPath)), false); err == nil {
+		t.Error("expected an error for testdata/bad.page.gohtml, but did not get one")
+	}
+}
+
+// Test_templates_noInlineStyles checks that no template has a style
+// attribute, which the default Content-Security-Policy blocks.
+func Test_templates_noInlineStyles(t *testing.T) {
+	err := fs.WalkDir(templates.FS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(templates.FS, name)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(content, []byte(" style=")) {
+			t.Errorf("%s has a style attribute, use a class in static/css/app.css instead", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_templateCache_reload(t *testing.T) {
+	dir := t.TempDir()
+	layout, err := os.ReadFile("./testdata/base.layout.gohtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTemplate := func(name, content string, modTime time.Time) {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now().Add(-time.Minute)
+	writeTemplate("base.layout.gohtml", string(layout), start)
+	writeTemplate("test.page.gohtml", `{{template "base" .}}{{define "content"}}first{{end}}`, start)
+
+	var tests = []struct {
+		name     string
+		reload   bool
+		expected string
+	}{
+		{"cached", false, "first"},
+		{"reloaded", true, "second"},
+	}
+
+	for _, e := range tests {
+		writeTemplate("test.page.gohtml", `{{template "base" .}}{{define "content"}}first{{end}}`, start)
+		c, err := newTemplateCache(os.DirFS(dir), templateFuncs(os.DirFS(staticPath)), e.reload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writeTemplate("test.page.gohtml", `{{template "base" .}}{{define "content"}}second{{end}}`, start.Add(time.Second))
+
+		tmpl, err := c.get("test.page.gohtml")
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, &TemplateData{}); err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+		if !strings.Contains(out.String(), e.expected) {
+			t.Errorf("%s: expected %s in %s", e.name, e.expected, out.String())
+		}
+	}
+
+	// a template broken while reloading is reported, and fixing it works
+	c, _ := newTemplateCache(os.DirFS(dir), templateFuncs(os.DirFS(staticPath)), true)
+	writeTemplate("test.page.gohtml", `{{template "base" .}}{{define "content"}}{{$nope}}{{end}}`, start.Add(2*time.Second))
+	if _, err := c.get("test.page.gohtml"); err == nil {
+		t.Error("expected an error for a broken template")
+	}
+	writeTemplate("test.page.gohtml", `{{template "base" .}}{{define "content"}}fixed{{end}}`, start.Add(3*time.Second))
+	if _, err := c.get("test.page.gohtml"); err != nil {
+		t.Errorf("expected the fixed template to load: %s", err)
+	}
+}
+
+func Test_app_renderStatus(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, app)
+	rr := httptest.NewRecorder()
+
+	if err := app.renderStatus(rr, req, http.StatusNotFound, "home.page.gohtml", &TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, but got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	if cl := rr.Header().Get("Content-Length"); cl != strconv.Itoa(rr.Body.Len()) {
+		t.Errorf("expected content length %d, but got %s", rr.Body.Len(), cl)
+	}
+}
+
+func Test_app_renderWithExecutionError(t *testing.T) {
+	dir := t.TempDir()
+	layout, err := os.ReadFile("./testdata/base.layout.gohtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "base.layout.gohtml"), layout, 0644)
+	_ = os.WriteFile(filepath.Join(dir, "broken.page.gohtml"), []byte(`{{template "base" .}}{{define "content"}}partial page{{.NoSuchField}}{{end}}`), 0644)
+
+	testApp := app
+	testApp.Templates, err = newTemplateCache(os.DirFS(dir), templateFuncs(os.DirFS(staticPath)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = addContextAndSessionToRequest(req, testApp)
+	rr := httptest.NewRecorder()
+
+	if err := testApp.render(rr, req, "broken.page.gohtml", &TemplateData{}); err == nil {
+		t.Error("expected an error from a template which fails to execute")
+	}
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, but got %d", rr.Code)
+	}
+	if strings.Contains(rr.Body.String(), "partial page") {
+		t.Error("expected nothing of the broken page to be sent")
+	}
+}
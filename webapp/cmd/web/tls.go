@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes.
+const certCheckInterval = 10 * time.Second
+
+// tlsSettings configures how the application serves HTTPS.
+type tlsSettings struct {
+	CertFile string
+	KeyFile  string
+	// Dev generates a self-signed certificate for localhost if the
+	// certificate files don't exist.
+	Dev bool
+	// RedirectAddr, when set, is where plain HTTP is served, redirecting
+	// everything to HTTPS.
+	RedirectAddr string
+}
+
+// enabled reports whether the application should serve HTTPS.
+func (s tlsSettings) enabled() bool {
+	return s.Dev || (s.CertFile != "" && s.KeyFile != "")
+}
+
+// certReloader serves a certificate from disk, reloading it when the files
+// change, so that renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile, interval: certCheckInterval}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastCheck) >= c.interval {
+		c.lastCheck = time.Now()
+		if modTime, err := c.latestModTime(); err == nil && modTime.After(c.modTime) {
+			if err := c.load(); err != nil {
+				// keep serving the old certificate until the new one is valid
+				log.Println("error reloading certificate:", err)
+			} else {
+				log.Println("reloaded certificate", c.certFile)
+			}
+		}
+	}
+
+	return c.cert, nil
+}
+
+func (c *certReloader) reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load()
+}
+
+// load reads the certificate files; the caller holds the lock.
+func (c *certReloader) load() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ensureDevCertificate writes a self-signed certificate for localhost to
+// certFile and keyFile, unless they exist already.
+func ensureDevCertificate(certFile, keyFile string) error {
+	if _, err := os.Stat(certFile); err == nil {
+		if _, err := os.Stat(keyFile); err == nil {
+			return nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"webapp development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			return err
+		}
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return err
+	}
+
+	log.Println("generated self-signed development certificate", certFile)
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+// redirectToHTTPS sends every request to the same url over HTTPS, on the
+// port of httpsAddr.
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// serve starts the server, over HTTPS when it is configured.
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:              app.Addr,
+		Handler:           app.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+
+	if !app.TLS.enabled() {
+		log.Printf("Starting server on %s (plain HTTP: secure session cookies won't be sent back)...", app.Addr)
+		return srv.ListenAndServe()
+	}
+
+	if app.TLS.Dev {
+		if app.TLS.CertFile == "" || app.TLS.KeyFile == "" {
+			app.TLS.CertFile = "./tmp/tls/cert.pem"
+			app.TLS.KeyFile = "./tmp/tls/key.pem"
+		}
+		if err := ensureDevCertificate(app.TLS.CertFile, app.TLS.KeyFile); err != nil {
+			return err
+		}
+	}
+
+	certs, err := newCertReloader(app.TLS.CertFile, app.TLS.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if app.TLS.RedirectAddr != "" {
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS...", app.TLS.RedirectAddr)
+			redirect := &http.Server{
+				Addr:              app.TLS.RedirectAddr,
+				Handler:           redirectToHTTPS(app.Addr),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			log.Fatal(redirect.ListenAndServe())
+		}()
+	}
+
+	log.Printf("Starting server on %s (HTTPS)...", app.Addr)
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_ensureDevCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls", "cert.pem")
+	keyFile := filepath.Join(dir, "tls", "key.pem")
+
+	if err := ensureDevCertificate(certFile, keyFile); err != nil {
+		t.Fatalf("error generating certificate: %s", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("generated certificate can't be loaded: %s", err)
+	}
+
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("certificate isn't valid for localhost: %s", err)
+	}
+
+	// existing certificates are left alone
+	before, _ := os.ReadFile(certFile)
+	_ = ensureDevCertificate(certFile, keyFile)
+	after, _ := os.ReadFile(certFile)
+	if string(before) != string(after) {
+		t.Error("existing certificate was replaced")
+	}
+}
+
+func Test_certReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	_ = ensureDevCertificate(certFile, keyFile)
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("error loading certificate: %s", err)
+	}
+	certs.interval = 0
+
+	first, _ := certs.GetCertificate(nil)
+
+	// replace the certificate, as a renewal would
+	_ = os.Remove(certFile)
+	_ = os.Remove(keyFile)
+	_ = ensureDevCertificate(certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+
+	second, _ := certs.GetCertificate(nil)
+	if string(first.Certificate[0]) == string(second.Certificate[0]) {
+		t.Error("expected the certificate to be reloaded after it changed")
+	}
+
+	// a broken certificate doesn't replace a working one
+	_ = os.WriteFile(certFile, []byte("not a certificate"), 0644)
+	later = later.Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+
+	third, err := certs.GetCertificate(nil)
+	if err != nil || third != second {
+		t.Error("expected the previous certificate to be kept when the new one is broken")
+	}
+}
+
+func Test_certReloader_serves(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	_ = ensureDevCertificate(certFile, keyFile)
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{GetCertificate: certs.GetCertificate}
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("error calling HTTPS server: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		t.Error("expected the response to come over TLS")
+	}
+}
+
+func Test_redirectToHTTPS(t *testing.T) {
+	var tests = []struct {
+		name        string
+		httpsAddr   string
+		url         string
+		expectedLoc string
+	}{
+		{"default port", ":443", "http://example.com/user/profile?x=1", "https://example.com/user/profile?x=1"},
+		{"custom port", ":8443", "http://example.com:8080/", "https://example.com:8443/"},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		redirectToHTTPS(e.httpsAddr).ServeHTTP(rr, httptest.NewRequest("GET", e.url, nil))
+
+		if rr.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: expected status %d, but got %d", e.name, http.StatusPermanentRedirect, rr.Code)
+		}
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
+	"webapp/pkg/totp"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// totpIssuer is the name authenticator apps show next to our codes.
+const totpIssuer = "webapp"
+
+// recoveryCodeCount is the number of recovery codes a user gets on enrolment.
+const recoveryCodeCount = 10
+
+// twoFactorTimeout is how long a user who entered their password has to
+// enter their code, and maxTwoFactorFailures how many wrong codes can be
+// entered for them, before they have to enter their password again.
+const (
+	twoFactorTimeout     = 5 * time.Minute
+	maxTwoFactorFailures = 5
+)
+
+// LoginTwoFactor shows the second login step, for users whose password has
+// been checked by Login.
+func (app *application) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.pendingSecondFactor(r) == 0 {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	_ = app.render(w, r, "two-factor.page.gohtml", &TemplateData{})
+}
+
+// PostLoginTwoFactor checks the code from an authenticator app, or a
+// recovery code, and logs the user in.
+func (app *application) PostLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := app.pendingSecondFactor(r)
+	if userID == 0 {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.DB.GetUser(userID)
+	if err != nil {
+		app.endSecondFactor(r)
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid login!"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if !app.checkSecondFactor(user, r.PostForm.Get("code"), r.PostForm.Get("recovery_code")) {
+		app.audit(r, data.AuditTwoFactorFailed, user.ID, nil)
+
+		// failures are counted for the user rather than the session, so
+		// that guessing from many sessions at once doesn't help
+		failures, err := app.DB.RecordTOTPFailure(user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if failures >= maxTwoFactorFailures {
+			if err := app.DB.ResetTOTPFailures(user.ID); err != nil {
+				log.Println(err)
+			}
+			app.endSecondFactor(r)
+			app.Session.Put(r.Context(), "error", app.T(r, "Too many wrong codes, please log in again"))
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid code"))
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.DB.ResetTOTPFailures(user.ID); err != nil {
+		log.Println(err)
+	}
+
+	remember := app.Session.GetBool(r.Context(), "2fa_remember")
+	app.endSecondFactor(r)
+
+	err = app.logUserIn(r, user, remember)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditLogin, user.ID, map[string]any{"remember": remember, "two_factor": true})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Successfully logged in!"))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// pendingSecondFactor returns the id of the user who entered their password
+// in this session and still has to enter their code, or 0 if there is
+// none. A user who took too long has to start again.
+func (app *application) pendingSecondFactor(r *http.Request) int {
+	userID := app.Session.GetInt(r.Context(), "2fa_user_id")
+	if userID == 0 {
+		return 0
+	}
+
+	if time.Now().Unix() > app.Session.GetInt64(r.Context(), "2fa_expires") {
+		app.endSecondFactor(r)
+		app.Session.Put(r.Context(), "error", app.T(r, "Your login has expired, please log in again"))
+		return 0
+	}
+
+	return userID
+}
+
+// endSecondFactor forgets the user who was entering their code.
+func (app *application) endSecondFactor(r *http.Request) {
+	app.Session.Remove(r.Context(), "2fa_user_id")
+	app.Session.Remove(r.Context(), "2fa_remember")
+	app.Session.Remove(r.Context(), "2fa_expires")
+}
+
+// checkSecondFactor reports whether code is the user's current totp code,
+// or recoveryCode is one of their unused recovery codes. A totp code only
+// works once.
+func (app *application) checkSecondFactor(user *data.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Match(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return false
+		}
+
+		fresh, err := app.DB.UseTOTPStep(user.ID, step)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		return fresh
+	}
+
+	if recoveryCode != "" {
+		ok, err := app.DB.UseRecoveryCode(user.ID, recoveryCode)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+		return ok
+	}
+
+	return false
+}
+
+// TwoFactorSetup shows the secret a user needs to enrol an authenticator
+// app, both as a QR code and as text.
+func (app *application) TwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+	if user.TOTPEnabled {
+		_ = app.render(w, r, "two-factor-setup.page.gohtml", &TemplateData{})
+		return
+	}
+
+	// keep the same secret until enrolment is finished, so that reloading
+	// the page doesn't invalidate a QR code that was already scanned
+	secret := app.Session.GetString(r.Context(), "totp_setup_secret")
+	if secret == "" {
+		var err error
+		secret, err = totp.GenerateSecret()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.Session.Put(r.Context(), "totp_setup_secret", secret)
+	}
+
+	png, err := qrcode.Encode(totp.URL(totpIssuer, user.Email, secret), qrcode.Medium, 256)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_ = app.render(w, r, "two-factor-setup.page.gohtml", &TemplateData{Data: map[string]any{
+		"secret": secret,
+		"qr":     template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+	}})
+}
+
+// PostTwoFactorSetup finishes enrolment once the user has proved their app
+// works by entering a code, and shows their recovery codes, once.
+func (app *application) PostTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	user, _ := reqctx.User(r.Context())
+	secret := app.Session.GetString(r.Context(), "totp_setup_secret")
+
+	if secret == "" || !totp.Validate(secret, r.PostForm.Get("code"), time.Now()) {
+		app.Session.Put(r.Context(), "error", app.T(r, "Invalid code, please try again"))
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.DB.EnableTOTP(user.ID, secret, codes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Session.Remove(r.Context(), "totp_setup_secret")
+	app.audit(r, data.AuditTwoFactorEnabled, user.ID, nil)
+	user.TOTPEnabled = true
+	app.putSessionUser(r, user)
+
+	_ = app.render(w, r, "recovery-codes.page.gohtml", &TemplateData{Data: map[string]any{
+		"codes": codes,
+	}})
+}
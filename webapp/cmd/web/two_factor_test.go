@@ -0,0 +1,252 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/totp"
+)
+
+// pendSecondFactor puts a user who entered their password in the session
+// of req, the way Login does.
+func pendSecondFactor(req *http.Request, app application, userID int) {
+	app.Session.Put(req.Context(), "2fa_user_id", userID)
+	app.Session.Put(req.Context(), "2fa_expires", time.Now().Add(twoFactorTimeout).Unix())
+}
+
+func Test_app_LoginTwoFactor(t *testing.T) {
+	var tests = []struct {
+		name         string
+		pending      bool
+		expectedCode int
+	}{
+		{"password checked", true, http.StatusOK},
+		{"password not checked", false, http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/login/2fa", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.pending {
+			pendSecondFactor(req, app, 2)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.LoginTwoFactor).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_PostLoginTwoFactor(t *testing.T) {
+	code, _ := totp.Code(dbrepo.TestTOTPSecret, time.Now())
+
+	var tests = []struct {
+		name           string
+		pending        bool
+		postedData     url.Values
+		expectedLoc    string
+		expectLoggedIn bool
+	}{
+		{"valid code", true, url.Values{"code": {code}}, "/user/profile", true},
+		{"valid recovery code", true, url.Values{"recovery_code": {"recovery-code"}}, "/user/profile", true},
+		{"invalid code", true, url.Values{"code": {"000000"}}, "/login/2fa", false},
+		{"invalid recovery code", true, url.Values{"recovery_code": {"nope"}}, "/login/2fa", false},
+		{"no code", true, url.Values{}, "/login/2fa", false},
+		{"password not checked", false, url.Values{"code": {code}}, "/", false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, app)
+		if e.pending {
+			pendSecondFactor(req, app, 2)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.PostLoginTwoFactor).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected status %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+
+		if app.Session.Exists(req.Context(), "user") != e.expectLoggedIn {
+			t.Errorf("%s: expected logged in to be %t", e.name, e.expectLoggedIn)
+		}
+	}
+}
+
+func Test_app_PostLoginTwoFactor_expired(t *testing.T) {
+	code, _ := totp.Code(dbrepo.TestTOTPSecret, time.Now())
+	postedData := url.Values{"code": {code}}
+	req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = addContextAndSessionToRequest(req, app)
+	app.Session.Put(req.Context(), "2fa_user_id", 2)
+	app.Session.Put(req.Context(), "2fa_expires", time.Now().Add(-time.Minute).Unix())
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.PostLoginTwoFactor).ServeHTTP(rr, req)
+
+	if loc := rr.Header().Get("Location"); loc != "/" {
+		t.Errorf("expected to be sent back to log in, but got %s", loc)
+	}
+	if app.Session.Exists(req.Context(), "user") || app.Session.Exists(req.Context(), "2fa_user_id") {
+		t.Error("expected the login to be abandoned")
+	}
+}
+
+// totpGuardRepo remembers the time steps used, and counts wrong codes.
+type totpGuardRepo struct {
+	dbrepo.TestDBRepo
+	lastStep int64
+	failures int
+}
+
+func (m *totpGuardRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	if step <= m.lastStep {
+		return false, nil
+	}
+	m.lastStep = step
+	return true, nil
+}
+
+func (m *totpGuardRepo) RecordTOTPFailure(userID int) (int, error) {
+	m.failures++
+	return m.failures, nil
+}
+
+func (m *totpGuardRepo) ResetTOTPFailures(userID int) error {
+	m.failures = 0
+	return nil
+}
+
+func Test_app_PostLoginTwoFactor_replay(t *testing.T) {
+	testApp := app
+	testApp.DB = &totpGuardRepo{}
+	code, _ := totp.Code(dbrepo.TestTOTPSecret, time.Now())
+
+	var tests = []struct {
+		name        string
+		expectedLoc string
+	}{
+		{"first use", "/user/profile"},
+		{"replayed", "/login/2fa"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{"code": {code}}
+		req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, testApp)
+		pendSecondFactor(req, testApp, 2)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.PostLoginTwoFactor).ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLoc {
+			t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLoc, loc)
+		}
+	}
+}
+
+func Test_app_PostLoginTwoFactor_tooManyFailures(t *testing.T) {
+	testApp := app
+	testApp.DB = &totpGuardRepo{}
+
+	req := httptest.NewRequest("POST", "/login/2fa", nil)
+	req = addContextAndSessionToRequest(req, testApp)
+	pendSecondFactor(req, testApp, 2)
+
+	for i := 1; i <= maxTwoFactorFailures; i++ {
+		postedData := url.Values{"code": {"000000"}}
+		attempt := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(postedData.Encode()))
+		attempt.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		attempt = attempt.WithContext(req.Context())
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testApp.PostLoginTwoFactor).ServeHTTP(rr, attempt)
+
+		expectedLoc := "/login/2fa"
+		if i == maxTwoFactorFailures {
+			expectedLoc = "/"
+		}
+		if loc := rr.Header().Get("Location"); loc != expectedLoc {
+			t.Errorf("attempt %d: expected location %s, but got %s", i, expectedLoc, loc)
+		}
+	}
+
+	if testApp.Session.Exists(req.Context(), "2fa_user_id") {
+		t.Error("expected the password to be needed again after too many wrong codes")
+	}
+}
+
+func Test_app_TwoFactorSetup(t *testing.T) {
+	req := httptest.NewRequest("GET", "/user/2fa", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1, Email: "admin@example.com"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.TwoFactorSetup).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, but got %d", rr.Code)
+	}
+
+	secret := app.Session.GetString(req.Context(), "totp_setup_secret")
+	if secret == "" {
+		t.Fatal("expected a secret to be put in the session")
+	}
+
+	body := rr.Body.String()
+	if !strings.Contains(body, secret) || !strings.Contains(body, "data:image/png;base64,") {
+		t.Error("expected the secret and a QR code in the page")
+	}
+}
+
+func Test_app_PostTwoFactorSetup(t *testing.T) {
+	secret, _ := totp.GenerateSecret()
+	code, _ := totp.Code(secret, time.Now())
+
+	var tests = []struct {
+		name         string
+		code         string
+		expectedCode int
+	}{
+		{"valid code", code, http.StatusOK},
+		{"invalid code", "000000", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{"code": {e.code}}
+		req := httptest.NewRequest("POST", "/user/2fa", strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: 1})
+		app.Session.Put(req.Context(), "totp_setup_secret", secret)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.PostTwoFactorSetup).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		user := app.Session.Get(req.Context(), "user").(data.User)
+		if user.TOTPEnabled != (e.expectedCode == http.StatusOK) {
+			t.Errorf("%s: unexpected two-factor state in session: %t", e.name, user.TOTPEnabled)
+		}
+	}
+}
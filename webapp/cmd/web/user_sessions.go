@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/reqctx"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// sessionTouchInterval limits how often the last seen time of a session is
+// written to the database.
+const sessionTouchInterval = time.Minute
+
+// randomToken returns n random bytes, encoded so that they are safe to use in
+// urls and cookies.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// startUserSession records a new logged in session for user, and keeps its
+// id in the session so that it can be revoked later.
+func (app *application) startUserSession(r *http.Request, user *data.User, remember bool) error {
+	id, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s := data.UserSession{
+		ID:        id,
+		UserID:    user.ID,
+		IP:        app.ipFromContext(r.Context()),
+		UserAgent: r.UserAgent(),
+		Remember:  remember,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(app.Lifetimes.lifetime(remember)),
+	}
+
+	if err := app.DB.InsertUserSession(s); err != nil {
+		return err
+	}
+
+	// the cookie only outlives the browser when "remember me" is checked
+	app.Session.RememberMe(r.Context(), remember)
+	app.Session.Put(r.Context(), "session_id", id)
+	return nil
+}
+
+// trackSession ends sessions which have been revoked or have outlived their
+// absolute lifetime, and keeps track of when the others were last used.
+func (app *application) trackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.Session.GetString(r.Context(), "session_id")
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s, err := app.DB.GetUserSession(id)
+		switch {
+		case err == sql.ErrNoRows || (err == nil && time.Now().After(s.ExpiresAt)):
+			_ = app.Session.Destroy(r.Context())
+			app.Session.Put(r.Context(), "error", app.T(r, "Your session has ended, please log in again."))
+		case err != nil:
+			log.Println("error loading session:", err)
+		case time.Since(s.LastSeen) > sessionTouchInterval:
+			if err := app.DB.TouchUserSession(id, app.ipFromContext(r.Context()), time.Now()); err != nil {
+				log.Println("error updating session:", err)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserSessions lists the active sessions of the logged in user.
+func (app *application) UserSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+
+	all, err := app.DB.AllUserSessions(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// sessions which have been idle for too long are gone, even though
+	// they haven't reached their absolute lifetime yet
+	var sessions []*data.UserSession
+	for _, s := range all {
+		if app.Lifetimes.Idle > 0 && time.Since(s.LastSeen) > app.Lifetimes.Idle {
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	_ = app.render(w, r, "sessions.page.gohtml", &TemplateData{Data: map[string]any{
+		"sessions": sessions,
+		"current":  app.Session.GetString(r.Context(), "session_id"),
+	}})
+}
+
+// RevokeUserSession logs the user out of one of their sessions.
+func (app *application) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+
+	s, err := app.DB.GetUserSession(chi.URLParam(r, "id"))
+	if err != nil || s.UserID != user.ID {
+		app.notFound(w, r)
+		return
+	}
+
+	if err := app.DB.DeleteUserSession(s.ID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditSessionRevoked, user.ID, map[string]any{"ip": s.IP, "user_agent": s.UserAgent})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Session revoked"))
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+// RevokeOtherUserSessions logs the user out of every session but this one.
+func (app *application) RevokeOtherUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, _ := reqctx.User(r.Context())
+
+	err := app.DB.DeleteUserSessions(user.ID, app.Session.GetString(r.Context(), "session_id"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, data.AuditSessionRevoked, user.ID, map[string]any{"all_others": true})
+
+	app.Session.Put(r.Context(), "flash", app.T(r, "Logged out of all other sessions"))
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func Test_app_startUserSession(t *testing.T) {
+	req := httptest.NewRequest("POST", "/login", nil)
+	req = addContextAndSessionToRequest(req, app)
+
+	err := app.startUserSession(req, &data.User{ID: 1}, true)
+	if err != nil {
+		t.Fatalf("error starting session: %s", err)
+	}
+
+	if app.Session.GetString(req.Context(), "session_id") == "" {
+		t.Error("expected session id to be put in the session")
+	}
+}
+
+func Test_app_trackSession(t *testing.T) {
+	var tests = []struct {
+		name           string
+		sessionID      string
+		expectLoggedIn bool
+	}{
+		{"no tracked session", "", true},
+		{"active session", "current", true},
+		{"revoked session", "revoked", false},
+		{"expired session", "expired", false},
+	}
+
+	for _, e := range tests {
+		var loggedIn bool
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			loggedIn = app.Session.Exists(r.Context(), "user")
+		})
+
+		req := httptest.NewRequest("GET", "/user/profile", nil)
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: 1})
+		if e.sessionID != "" {
+			app.Session.Put(req.Context(), "session_id", e.sessionID)
+		}
+
+		app.trackSession(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+		if loggedIn != e.expectLoggedIn {
+			t.Errorf("%s: expected logged in to be %t, but got %t", e.name, e.expectLoggedIn, loggedIn)
+		}
+	}
+}
+
+func Test_app_UserSessions(t *testing.T) {
+	req := httptest.NewRequest("GET", "/user/sessions", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1})
+	app.Session.Put(req.Context(), "session_id", "current")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.UserSessions).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, but got %d", rr.Code)
+	}
+
+	if !strings.Contains(rr.Body.String(), "This session") {
+		t.Error("expected the current session to be marked")
+	}
+}
+
+func Test_app_RevokeUserSession(t *testing.T) {
+	var tests = []struct {
+		name         string
+		id           string
+		userID       int
+		expectedCode int
+	}{
+		{"own session", "other", 1, http.StatusSeeOther},
+		{"someone else's session", "other", 2, http.StatusNotFound},
+		{"missing session", "revoked", 1, http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/user/sessions/"+e.id+"/revoke", nil)
+		req = addContextAndSessionToRequest(req, app)
+		req = logIn(req, app, data.User{ID: e.userID})
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.RevokeUserSession).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func Test_app_RevokeOtherUserSessions(t *testing.T) {
+	req := httptest.NewRequest("POST", "/user/sessions/revoke-others", nil)
+	req = addContextAndSessionToRequest(req, app)
+	req = logIn(req, app, data.User{ID: 1})
+	app.Session.Put(req.Context(), "session_id", "current")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.RevokeOtherUserSessions).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected status 303, but got %d", rr.Code)
+	}
+}
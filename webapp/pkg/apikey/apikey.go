@@ -0,0 +1,69 @@
+// Package apikey generates personal API keys. A key is made of a public
+// prefix, used to look it up, and a secret; only a hash of the whole key is
+// stored, so a leaked database doesn't leak working keys.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// tag starts every key, so that keys are easy to spot, eg by secret
+// scanners.
+const tag = "wak"
+
+// prefixLen is the length of the lookup prefix.
+const prefixLen = 8
+
+var prefixEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Key is a newly generated API key. Plain is only known at this point, and
+// has to be shown to the user straight away.
+type Key struct {
+	Plain  string
+	Prefix string
+	Hash   string
+}
+
+// Generate returns a new random key.
+func Generate() (Key, error) {
+	p := make([]byte, 5)
+	if _, err := rand.Read(p); err != nil {
+		return Key{}, err
+	}
+	s := make([]byte, 32)
+	if _, err := rand.Read(s); err != nil {
+		return Key{}, err
+	}
+
+	prefix := strings.ToLower(prefixEncoding.EncodeToString(p))
+	plain := tag + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(s)
+
+	return Key{Plain: plain, Prefix: prefix, Hash: Hash(plain)}, nil
+}
+
+// Prefix returns the lookup prefix of a key, or false if it doesn't look
+// like one of our keys.
+func Prefix(plain string) (string, bool) {
+	parts := strings.SplitN(plain, "_", 3)
+	if len(parts) != 3 || parts[0] != tag || len(parts[1]) != prefixLen || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// Hash returns the hash of a key, as stored.
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports whether plain is the key with hash, in constant time.
+func Matches(plain, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(plain)), []byte(hash)) == 1
+}
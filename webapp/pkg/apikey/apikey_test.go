@@ -0,0 +1,57 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	key, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key.Plain, "wak_"+key.Prefix+"_") {
+		t.Errorf("expected key %s to start with its prefix %s", key.Plain, key.Prefix)
+	}
+
+	prefix, ok := Prefix(key.Plain)
+	if !ok || prefix != key.Prefix {
+		t.Errorf("expected prefix %s, but got %s, %t", key.Prefix, prefix, ok)
+	}
+
+	if !Matches(key.Plain, key.Hash) {
+		t.Error("expected the key to match its hash")
+	}
+	if Matches(key.Plain+"x", key.Hash) {
+		t.Error("expected another key not to match the hash")
+	}
+
+	other, _ := Generate()
+	if other.Plain == key.Plain || other.Prefix == key.Prefix {
+		t.Error("expected keys to be random")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	var tests = []struct {
+		name     string
+		plain    string
+		expected string
+		ok       bool
+	}{
+		{"valid", "wak_abcdefgh_secret", "abcdefgh", true},
+		{"secret with underscores", "wak_abcdefgh_sec_ret", "abcdefgh", true},
+		{"other tag", "ghp_abcdefgh_secret", "", false},
+		{"short prefix", "wak_abc_secret", "", false},
+		{"no secret", "wak_abcdefgh_", "", false},
+		{"garbage", "hello", "", false},
+	}
+
+	for _, e := range tests {
+		prefix, ok := Prefix(e.plain)
+		if prefix != e.expected || ok != e.ok {
+			t.Errorf("%s: expected %q, %t, but got %q, %t", e.name, e.expected, e.ok, prefix, ok)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package data
+
+import "time"
+
+// Scopes an API key can be limited to.
+const (
+	ScopeProfileRead = "profile:read"
+	ScopeAuditRead   = "audit:read"
+)
+
+// APIScopes lists every scope, for the key creation form.
+var APIScopes = []string{
+	ScopeProfileRead,
+	ScopeAuditRead,
+}
+
+// APIKey is a personal API key, which lets programs act as a user without a
+// browser session. Only a hash of the key is stored.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key can still be used at time now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key was given scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package data
+
+import "time"
+
+// Types of security relevant events recorded in the audit log.
+const (
+	AuditLogin             = "login"
+	AuditLoginFailed       = "login_failed"
+	AuditLogout            = "logout"
+	AuditLogoutEverywhere  = "logout_everywhere"
+	AuditSessionRevoked    = "session_revoked"
+	AuditProfilePicChanged = "profile_pic_changed"
+	AuditProfileUpdated    = "profile_updated"
+	AuditTwoFactorEnabled  = "two_factor_enabled"
+	AuditTwoFactorFailed   = "two_factor_failed"
+	AuditTwoFactorReset    = "two_factor_reset"
+	AuditPasswordChanged   = "password_changed"
+	AuditUserDeleted       = "user_deleted"
+	AuditUserRestored      = "user_restored"
+	AuditEmailVerified     = "email_verified"
+	AuditIdentityLinked    = "identity_linked"
+	AuditRoleAssigned      = "role_assigned"
+	AuditRoleRevoked       = "role_revoked"
+	AuditAPIKeyCreated     = "api_key_created"
+	AuditAPIKeyRevoked     = "api_key_revoked"
+	AuditDataExported      = "data_exported"
+)
+
+// AuditEventTypes lists every audit event type, for filtering.
+var AuditEventTypes = []string{
+	AuditLogin,
+	AuditLoginFailed,
+	AuditLogout,
+	AuditLogoutEverywhere,
+	AuditSessionRevoked,
+	AuditProfilePicChanged,
+	AuditProfileUpdated,
+	AuditTwoFactorEnabled,
+	AuditTwoFactorFailed,
+	AuditTwoFactorReset,
+	AuditPasswordChanged,
+	AuditUserDeleted,
+	AuditUserRestored,
+	AuditEmailVerified,
+	AuditIdentityLinked,
+	AuditRoleAssigned,
+	AuditRoleRevoked,
+	AuditAPIKeyCreated,
+	AuditAPIKeyRevoked,
+	AuditDataExported,
+}
+
+// AuditEvent is one entry of the audit log. ActorID is the user who did
+// something, TargetUserID the user it was done to; either is 0 when there
+// is no such user, eg for a failed login with an unknown email address.
+type AuditEvent struct {
+	ID           int            `json:"id"`
+	ActorID      int            `json:"actor_id"`
+	TargetUserID int            `json:"target_user_id"`
+	IP           string         `json:"ip"`
+	UserAgent    string         `json:"user_agent"`
+	Type         string         `json:"type"`
+	Details      map[string]any `json:"details"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// AuditFilter narrows down the audit events returned by a query. Zero
+// values don't filter.
+type AuditFilter struct {
+	Type   string
+	UserID int // matches either the actor or the target
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,24 @@
+package data
+
+// Roles every install has.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// Permissions which routes can require.
+const (
+	PermUsersRead     = "users:read"
+	PermUsersDelete   = "users:delete"
+	PermUsersReset2FA = "users:reset-2fa"
+	PermAuditRead     = "audit:read"
+	PermRolesManage   = "roles:manage"
+)
+
+// Role is a named set of permissions, which users are given.
+type Role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+// UserIdentity links a user to their account with an external identity
+// provider, so that they can log in with it.
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
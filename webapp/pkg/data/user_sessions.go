@@ -0,0 +1,16 @@
+package data
+
+import "time"
+
+// UserSession describes one logged in session of a user, so that users can
+// see where they are logged in and revoke sessions they don't recognise.
+type UserSession struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Remember  bool      `json:"remember"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
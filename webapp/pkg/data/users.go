@@ -1,39 +1,37 @@
 package data
 
 import (
-	"errors"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
+	"webapp/pkg/passwords"
 )
 
 // User describes the data for the User type.
 type User struct {
-	ID         int       `json:"id"`
-	FirstName  string    `json:"first_name"`
-	LastName   string    `json:"last_name"`
-	Email      string    `json:"email"`
-	Password   string    `json:"-"`
-	IsAdmin    int       `json:"is_admin"`
-	CreatedAt  time.Time `json:"-"`
-	UpdatedAt  time.Time `json:"-"`
-	ProfilePic UserImage `json:"_"`
+	ID              int        `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	IsAdmin         int        `json:"is_admin"`
+	TOTPSecret      string     `json:"-"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"-"`
+	UpdatedAt       time.Time  `json:"-"`
+	DeletedAt       *time.Time `json:"-"`
+	ProfilePic      UserImage  `json:"_"`
 }
 
-// PasswordMatches uses Go's bcrypt package to compare a user supplied password
-// with the hash we have stored for a given user in the database. If the password
-// and hash match, we return true; otherwise, we return false.
-func (u *User) PasswordMatches(plainText string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(plainText))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			// invalid password
-			return false, nil
-		default:
-			return false, err
-		}
-	}
+// EmailVerified reports whether the user has proved they own their current
+// email address. EmailVerifiedAt is nil until they do.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
 
-	return true, nil
+// PasswordMatches compares a user supplied password with the hash we have
+// stored for a given user in the database, whether it is an argon2id or a
+// legacy bcrypt hash. If the password and hash match, we return true;
+// otherwise, we return false.
+func (u *User) PasswordMatches(plainText string) (bool, error) {
+	return passwords.Verify(u.Password, plainText)
 }
@@ -0,0 +1,172 @@
+// Package i18n translates user facing text. Messages are looked up by their
+// English text, which is also what is shown when a message hasn't been
+// translated, so English needs no messages of its own.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fallback is the locale messages are written in.
+const Fallback = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalog is the content of a locales/<locale>.json file.
+type catalog struct {
+	// Name is the name of the language, in that language, eg Deutsch.
+	Name     string            `json:"name"`
+	Messages map[string]string `json:"messages"`
+}
+
+// Bundle holds the catalogs of all supported locales.
+type Bundle struct {
+	catalogs map[string]catalog
+}
+
+// New returns a bundle with the built in catalogs.
+func New() (*Bundle, error) {
+	return Load(locales, "locales")
+}
+
+// Load reads a catalog from every <locale>.json file in dir.
+func Load(fsys fs.FS, dir string) (*Bundle, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{catalogs: map[string]catalog{
+		Fallback: {Name: "English"},
+	}}
+
+	for _, f := range files {
+		content, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+
+		var c catalog
+		if err := json.Unmarshal(content, &c); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", f, err)
+		}
+
+		locale := strings.ToLower(strings.TrimSuffix(path.Base(f), ".json"))
+		b.catalogs[locale] = c
+	}
+
+	return b, nil
+}
+
+// Language is a supported locale and the name of its language.
+type Language struct {
+	Locale string
+	Name   string
+}
+
+// Languages returns the supported languages, sorted by locale.
+func (b *Bundle) Languages() []Language {
+	var languages []Language
+	for locale, c := range b.catalogs {
+		languages = append(languages, Language{Locale: locale, Name: c.Name})
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		return languages[i].Locale < languages[j].Locale
+	})
+	return languages
+}
+
+// Supported reports whether there is a catalog for locale.
+func (b *Bundle) Supported(locale string) bool {
+	_, ok := b.catalogs[locale]
+	return ok
+}
+
+// Negotiate picks the supported locale the client prefers most, from an
+// Accept-Language header, eg "de-AT,de;q=0.9,en;q=0.5". A regional locale
+// the bundle doesn't have matches its language, so de-AT gets de.
+func (b *Bundle) Negotiate(acceptLanguage string) string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(params[2:], 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag == "" || q <= 0 {
+			continue
+		}
+		preferences = append(preferences, preference{tag: strings.ToLower(tag), q: q})
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].q > preferences[j].q
+	})
+
+	for _, p := range preferences {
+		if b.Supported(p.tag) {
+			return p.tag
+		}
+		if language, _, ok := strings.Cut(p.tag, "-"); ok && b.Supported(language) {
+			return language
+		}
+	}
+
+	return Fallback
+}
+
+// Printer returns a printer for locale, or for the fallback locale if
+// locale isn't supported.
+func (b *Bundle) Printer(locale string) *Printer {
+	c, ok := b.catalogs[locale]
+	if !ok {
+		locale, c = Fallback, b.catalogs[Fallback]
+	}
+	return &Printer{locale: locale, messages: c.Messages}
+}
+
+// Printer translates messages into one locale.
+type Printer struct {
+	locale   string
+	messages map[string]string
+}
+
+// Locale returns the locale of the printer; a nil printer prints the
+// fallback locale.
+func (p *Printer) Locale() string {
+	if p == nil {
+		return Fallback
+	}
+	return p.locale
+}
+
+// T translates message, and formats it with args, like fmt.Sprintf.
+// Messages without a translation are formatted as they are.
+func (p *Printer) T(message string, args ...any) string {
+	if p != nil {
+		if translated, ok := p.messages[message]; ok && translated != "" {
+			message = translated
+		}
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
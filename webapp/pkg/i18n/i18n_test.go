@@ -0,0 +1,139 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, locale := range []string{"en", "de"} {
+		if !b.Supported(locale) {
+			t.Errorf("expected %s to be supported", locale)
+		}
+	}
+
+	languages := b.Languages()
+	if len(languages) < 2 || languages[0].Locale != "de" || languages[0].Name != "Deutsch" {
+		t.Errorf("unexpected languages %+v", languages)
+	}
+}
+
+// TestCatalogs checks that translations use the same verbs as the messages
+// they translate, so that no argument goes missing.
+func TestCatalogs(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verbs := regexp.MustCompile(`%[a-z]`)
+	for locale, c := range b.catalogs {
+		for message, translated := range c.Messages {
+			expected := verbs.FindAllString(message, -1)
+			got := verbs.FindAllString(translated, -1)
+			if len(expected) != len(got) {
+				t.Errorf("%s: %q has verbs %v but its translation has %v", locale, message, expected, got)
+				continue
+			}
+			for i := range expected {
+				if expected[i] != got[i] {
+					t.Errorf("%s: %q has verbs %v but its translation has %v", locale, message, expected, got)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/fr.json":  {Data: []byte(`{"name": "Français", "messages": {"Hello": "Bonjour"}}`)},
+		"locales/bad.json": {Data: []byte(`{`)},
+	}
+
+	if _, err := Load(fsys, "locales"); err == nil {
+		t.Error("expected an error for a broken catalog")
+	}
+
+	delete(fsys, "locales/bad.json")
+	b, err := Load(fsys, "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Supported("fr") || !b.Supported(Fallback) {
+		t.Errorf("unexpected languages %+v", b.Languages())
+	}
+	if got := b.Printer("fr").T("Hello"); got != "Bonjour" {
+		t.Errorf("expected Bonjour but got %q", got)
+	}
+}
+
+func TestBundle_Negotiate(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+	}{
+		{"empty", "", "en"},
+		{"exact", "de", "de"},
+		{"upper case", "DE", "de"},
+		{"region", "de-AT", "de"},
+		{"unsupported", "fr", "en"},
+		{"first supported", "fr, de;q=0.8, en;q=0.5", "de"},
+		{"by q-value", "en;q=0.5, de;q=0.9", "de"},
+		{"refused", "de;q=0, en", "en"},
+		{"bad q-value", "de;q=x, en;q=0.1", "en"},
+		{"wildcard", "*", "en"},
+	}
+
+	for _, e := range tests {
+		if got := b.Negotiate(e.acceptLanguage); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestPrinter_T(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		printer  *Printer
+		message  string
+		args     []any
+		expected string
+	}{
+		{"translated", b.Printer("de"), "Log out", nil, "Abmelden"},
+		{"translated with args", b.Printer("de"), "Role %s assigned", []any{"admin"}, "Rolle admin zugewiesen"},
+		{"untranslated", b.Printer("de"), "Something new", nil, "Something new"},
+		{"untranslated with args", b.Printer("de"), "%d new things", []any{3}, "3 new things"},
+		{"fallback", b.Printer("en"), "Log out", nil, "Log out"},
+		{"unsupported locale", b.Printer("xx"), "Log out", nil, "Log out"},
+		{"no args leaves verbs alone", b.Printer("en"), "100% sure", nil, "100% sure"},
+		{"nil printer", nil, "Role %s assigned", []any{"admin"}, "Role admin assigned"},
+	}
+
+	for _, e := range tests {
+		if got := e.printer.T(e.message, e.args...); got != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, got)
+		}
+	}
+
+	if locale := b.Printer("xx").Locale(); locale != Fallback {
+		t.Errorf("expected the fallback locale but got %s", locale)
+	}
+}
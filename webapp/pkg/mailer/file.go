@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes each message to a .eml file in Dir, so that mail can be
+// read during development without a mail server.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to a new file.
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	to := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, msg.To)
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), to)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.bytes(m.From, now), 0600)
+}
@@ -0,0 +1,213 @@
+// Package oidc is a small OpenID Connect client for logging users in with an
+// external identity provider, using the authorization code flow with PKCE.
+// Only RS256 signed ID tokens are accepted.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes a client registered with a provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes requested besides "openid"; defaults to email and profile.
+	Scopes []string
+	// HTTPClient is used to talk to the provider; defaults to a client with
+	// a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// Provider is an OpenID Connect provider, as described by its discovery
+// document.
+type Provider struct {
+	config                Config
+	client                *http.Client
+	issuer                string
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	mu   sync.Mutex
+	keys map[string]*jsonWebKey
+}
+
+// Token is the response of the token endpoint.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+}
+
+// Discover fetches the discovery document of the issuer in config.
+func Discover(ctx context.Context, config Config) (*Provider, error) {
+	p := &Provider{config: config, client: config.HTTPClient}
+	if p.client == nil {
+		p.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(p.config.Scopes) == 0 {
+		p.config.Scopes = []string{"email", "profile"}
+	}
+
+	wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+
+	var doc struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+
+	// the issuer has to be exactly the one we asked for, or tokens from one
+	// provider could be passed off as another's
+	if doc.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc: discovery: issuer %q doesn't match %q", doc.Issuer, config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery: missing endpoints")
+	}
+
+	p.issuer = doc.Issuer
+	p.authorizationEndpoint = doc.AuthorizationEndpoint
+	p.tokenEndpoint = doc.TokenEndpoint
+	p.jwksURI = doc.JWKSURI
+
+	return p, nil
+}
+
+// Issuer returns the issuer identifier of the provider.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthCodeURL returns the url to send the user to, to log in with the
+// provider. state and nonce tie the response to this request, and verifier
+// is the PKCE code verifier, which is sent as its S256 challenge.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authorizationEndpoint + sep + v.Encode()
+}
+
+// ReauthURL is AuthCodeURL for a user who has to prove it's still them: the
+// provider is asked to have them log in again, rather than rely on a session
+// it has with them, and to say when they did in the auth_time claim.
+func (p *Provider) ReauthURL(state, nonce, verifier string) string {
+	return p.AuthCodeURL(state, nonce, verifier) + "&" + url.Values{
+		"prompt":  {"login"},
+		"max_age": {"0"},
+	}.Encode()
+}
+
+// Exchange trades an authorization code for tokens.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token: %s: %s", resp.Status, body)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("oidc: token: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("oidc: token: no id_token in response")
+	}
+
+	return &token, nil
+}
+
+// Verifier returns a new random PKCE code verifier.
+func Verifier() (string, error) {
+	return randomString(32)
+}
+
+// Challenge returns the S256 PKCE code challenge of a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes, base64 encoded.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
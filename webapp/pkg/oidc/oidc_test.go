@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	fake := oidctest.NewProvider()
+	t.Cleanup(fake.Close)
+
+	p, err := Discover(context.Background(), Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     fake.ClientID,
+		ClientSecret: fake.ClientSecret,
+		RedirectURL:  "http://localhost/callback",
+	})
+	if err != nil {
+		t.Fatalf("error discovering provider: %s", err)
+	}
+
+	return fake, p
+}
+
+// login goes through the authorization code flow, and returns the code.
+func login(t *testing.T, fake *oidctest.Provider, p *Provider, state, nonce, verifier string) string {
+	redirect, err := fake.Authorize(p.AuthCodeURL(state, nonce, verifier))
+	if err != nil {
+		t.Fatalf("error authorizing: %s", err)
+	}
+	if redirect.Query().Get("state") != state {
+		t.Errorf("expected state %s, but got %s", state, redirect.Query().Get("state"))
+	}
+	return redirect.Query().Get("code")
+}
+
+func TestDiscover(t *testing.T) {
+	fake := oidctest.NewProvider()
+	defer fake.Close()
+
+	_, err := Discover(context.Background(), Config{Issuer: fake.Issuer() + "/other"})
+	if err == nil {
+		t.Error("expected an error discovering a missing provider, but didn't get one")
+	}
+
+	// the issuer in the document has to match exactly
+	_, err = Discover(context.Background(), Config{Issuer: fake.Issuer() + "/"})
+	if err == nil {
+		t.Error("expected an error for a mismatched issuer, but didn't get one")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// from RFC 7636, appendix B
+	challenge := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("unexpected challenge %s", challenge)
+	}
+}
+
+func TestProvider_login(t *testing.T) {
+	fake, p := newTestProvider(t)
+
+	verifier, _ := Verifier()
+	code := login(t, fake, p, "the-state", "the-nonce", verifier)
+
+	token, err := p.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("error exchanging code: %s", err)
+	}
+
+	claims, err := p.VerifyIDToken(context.Background(), token.IDToken, "the-nonce")
+	if err != nil {
+		t.Fatalf("error verifying id token: %s", err)
+	}
+	if claims.Subject != "fake-subject" || claims.Email != "someone@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// codes can only be used once
+	if _, err := p.Exchange(context.Background(), code, verifier); err == nil {
+		t.Error("expected an error using a code twice, but didn't get one")
+	}
+}
+
+func TestProvider_Exchange_wrongVerifier(t *testing.T) {
+	fake, p := newTestProvider(t)
+
+	verifier, _ := Verifier()
+	code := login(t, fake, p, "state", "nonce", verifier)
+
+	other, _ := Verifier()
+	if _, err := p.Exchange(context.Background(), code, other); err == nil {
+		t.Error("expected an error with the wrong code verifier, but didn't get one")
+	}
+}
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	var tests = []struct {
+		name        string
+		claims      func(map[string]any)
+		nonce       string
+		expectedErr string
+	}{
+		{"valid", nil, "nonce", ""},
+		{"wrong nonce", nil, "other", "nonce"},
+		{"wrong issuer", func(c map[string]any) { c["iss"] = "https://evil.example.com" }, "nonce", "issuer"},
+		{"wrong audience", func(c map[string]any) { c["aud"] = []string{"another-client"} }, "nonce", "client"},
+		{"audience list", func(c map[string]any) { c["aud"] = []string{"another-client", "test-client"} }, "nonce", ""},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "nonce", "expired"},
+		{"issued in the future", func(c map[string]any) { c["iat"] = time.Now().Add(time.Hour).Unix() }, "nonce", "future"},
+		{"no subject", func(c map[string]any) { c["sub"] = "" }, "nonce", "subject"},
+	}
+
+	for _, e := range tests {
+		fake, p := newTestProvider(t)
+		fake.Claims = e.claims
+
+		verifier, _ := Verifier()
+		code := login(t, fake, p, "state", "nonce", verifier)
+
+		token, err := p.Exchange(context.Background(), code, verifier)
+		if err != nil {
+			t.Fatalf("%s: error exchanging code: %s", e.name, err)
+		}
+
+		_, err = p.VerifyIDToken(context.Background(), token.IDToken, e.nonce)
+		if e.expectedErr == "" && err != nil {
+			t.Errorf("%s: expected no error, but got %s", e.name, err)
+		}
+		if e.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), e.expectedErr)) {
+			t.Errorf("%s: expected an error about %s, but got %v", e.name, e.expectedErr, err)
+		}
+	}
+}
+
+func TestProvider_VerifyIDToken_tampered(t *testing.T) {
+	fake, p := newTestProvider(t)
+
+	verifier, _ := Verifier()
+	code := login(t, fake, p, "state", "nonce", verifier)
+	token, _ := p.Exchange(context.Background(), code, verifier)
+
+	parts := strings.Split(token.IDToken, ".")
+
+	var tests = []struct {
+		name  string
+		token string
+	}{
+		{"other payload", parts[0] + "." + parts[0] + "." + parts[2]},
+		{"no signature", parts[0] + "." + parts[1] + "."},
+		{"alg none", "eyJhbGciOiJub25lIn0." + parts[1] + "."},
+		{"malformed", "not-a-token"},
+	}
+
+	for _, e := range tests {
+		if _, err := p.VerifyIDToken(context.Background(), e.token, "nonce"); err == nil {
+			t.Errorf("%s: expected an error, but didn't get one", e.name)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var errInvalidArgon2idHash = errors.New("passwords: invalid argon2id hash")
+
+// Argon2id hashes passwords with argon2id, storing them in the PHC string
+// format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2id struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// NewArgon2id returns an Argon2id hasher with the parameters recommended by
+// RFC 9106 for memory constrained environments.
+func NewArgon2id() *Argon2id {
+	return &Argon2id{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Hash returns the argon2id hash of password.
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Matches compares a password with a hash of any supported scheme.
+func (a *Argon2id) Matches(hash, password string) (bool, error) {
+	return Verify(hash, password)
+}
+
+// NeedsRehash reports whether hash isn't an argon2id hash with the current
+// parameters.
+func (a *Argon2id) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != a.Memory ||
+		params.Iterations != a.Iterations ||
+		params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength ||
+		uint32(len(key)) != a.KeyLength
+}
+
+// verifyArgon2id compares a password with an argon2id hash, using the
+// parameters stored in the hash.
+func verifyArgon2id(hash, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func decodeArgon2id(hash string) (*Argon2id, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, nil, nil, errInvalidArgon2idHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, errInvalidArgon2idHash
+	}
+
+	var params Argon2id
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return nil, nil, nil, errInvalidArgon2idHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, errInvalidArgon2idHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errInvalidArgon2idHash
+	}
+
+	return &params, salt, key, nil
+}
@@ -0,0 +1,110 @@
+// Package passwords hashes passwords and checks them against a password
+// policy.
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes new passwords, and checks passwords against stored hashes.
+type Hasher interface {
+	// Hash returns the hash of password, in a self describing format.
+	Hash(password string) (string, error)
+	// Matches compares a password with a hash made by any supported
+	// scheme. A mismatch is not an error.
+	Matches(hash, password string) (bool, error)
+	// NeedsRehash reports whether hash should be replaced by a new one
+	// next time the password is known, because it was made with another
+	// scheme or weaker parameters.
+	NeedsRehash(hash string) bool
+}
+
+// New returns the hasher for scheme, "argon2id" or "bcrypt". bcryptCost is
+// only used for bcrypt.
+func New(scheme string, bcryptCost int) (Hasher, error) {
+	switch scheme {
+	case "argon2id":
+		return NewArgon2id(), nil
+	case "bcrypt":
+		return &Bcrypt{Cost: bcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing scheme %q", scheme)
+	}
+}
+
+// Verify compares a password with a hash, whichever supported scheme made
+// it. A mismatch is not an error.
+func Verify(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(hash, password)
+	}
+	return verifyBcrypt(hash, password)
+}
+
+// MaxBytes returns the length in bytes after which h ignores the rest of a
+// password, or 0 if it uses all of it. bcrypt only uses the first 72 bytes.
+func MaxBytes(h Hasher) int {
+	if _, ok := h.(*Bcrypt); ok {
+		return 72
+	}
+	return 0
+}
+
+// DefaultCost is the bcrypt cost used when none is configured.
+const DefaultCost = 12
+
+// Bcrypt hashes passwords with bcrypt at a configurable cost. A nil *Bcrypt
+// uses DefaultCost.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b *Bcrypt) cost() int {
+	if b == nil || b.Cost == 0 {
+		return DefaultCost
+	}
+	return b.Cost
+}
+
+// Hash returns the bcrypt hash of password.
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost())
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Matches compares a password with a hash of any supported scheme.
+func (b *Bcrypt) Matches(hash, password string) (bool, error) {
+	return Verify(hash, password)
+}
+
+// NeedsRehash reports whether hash isn't a bcrypt hash, or was made with a
+// lower cost than the current one.
+func (b *Bcrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost < b.cost()
+}
+
+func verifyBcrypt(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			// invalid password
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,190 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcrypt(t *testing.T) {
+	hasher := &Bcrypt{Cost: bcrypt.MinCost}
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := hasher.Matches(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("expected password to match its hash, got %t, %v", ok, err)
+	}
+
+	if ok, err := hasher.Matches(hash, "battery staple"); err != nil || ok {
+		t.Errorf("expected wrong password not to match, got %t, %v", ok, err)
+	}
+
+	if _, err := hasher.Matches("not a hash", "correct horse"); err == nil {
+		t.Error("expected an error comparing with a malformed hash")
+	}
+}
+
+func TestBcrypt_NeedsRehash(t *testing.T) {
+	weak, _ := (&Bcrypt{Cost: bcrypt.MinCost}).Hash("correct horse")
+
+	var tests = []struct {
+		name     string
+		cost     int
+		hash     string
+		expected bool
+	}{
+		{"same cost", bcrypt.MinCost, weak, false},
+		{"cost went up", bcrypt.MinCost + 1, weak, true},
+		{"cost went down", bcrypt.MinCost - 1, weak, false},
+		{"not a bcrypt hash", bcrypt.MinCost, "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$a2V5", true},
+	}
+
+	for _, e := range tests {
+		if got := (&Bcrypt{Cost: e.cost}).NeedsRehash(e.hash); got != e.expected {
+			t.Errorf("%s: expected %t, but got %t", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	strict := DefaultPolicy()
+	_ = strict.SetClasses("upper,lower,digit,symbol")
+	forBcrypt := DefaultPolicy()
+	forBcrypt.MaxBytes = MaxBytes(&Bcrypt{})
+
+	var tests = []struct {
+		name             string
+		policy           *Policy
+		password         string
+		expectedProblems int
+	}{
+		{"long enough", DefaultPolicy(), "correct horse", 0},
+		{"too short", DefaultPolicy(), "horse", 1},
+		{"breached", DefaultPolicy(), "Password123", 1},
+		{"too long for bcrypt", forBcrypt, strings.Repeat("a", 73), 1},
+		{"long without bcrypt", DefaultPolicy(), strings.Repeat("a", 73), 0},
+		{"all classes", strict, "Correct horse 1", 0},
+		{"missing classes", strict, "correcthorse", 3},
+	}
+
+	for _, e := range tests {
+		problems := e.policy.Validate(e.password)
+		if len(problems) != e.expectedProblems {
+			t.Errorf("%s: expected %d problems, but got %v", e.name, e.expectedProblems, problems)
+		}
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	if n := MaxBytes(&Bcrypt{}); n != 72 {
+		t.Errorf("expected bcrypt to use 72 bytes, but got %d", n)
+	}
+	if n := MaxBytes(NewArgon2id()); n != 0 {
+		t.Errorf("expected argon2id to use the whole password, but got %d", n)
+	}
+}
+
+func TestPolicy_SetClasses(t *testing.T) {
+	var p Policy
+	if err := p.SetClasses("upper, digit"); err != nil {
+		t.Fatal(err)
+	}
+	if !p.RequireUpper || !p.RequireDigit || p.RequireLower || p.RequireSymbol {
+		t.Errorf("unexpected classes: %+v", p)
+	}
+
+	if err := p.SetClasses("emoji"); err == nil {
+		t.Error("expected an error for an unknown class")
+	}
+}
+
+func TestPolicy_LoadBreached(t *testing.T) {
+	p := &Policy{}
+	err := p.LoadBreached(strings.NewReader("# comment\nHunter2\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Breached) != 1 {
+		t.Errorf("expected 1 breached password, but got %d", len(p.Breached))
+	}
+	if len(p.Validate("hunter2")) == 0 {
+		t.Error("breached passwords should be matched case insensitively")
+	}
+}
+
+func TestArgon2id(t *testing.T) {
+	hasher := &Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("hash isn't in PHC string format: %s", hash)
+	}
+
+	if ok, err := hasher.Matches(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("expected password to match its hash, got %t, %v", ok, err)
+	}
+
+	if ok, err := hasher.Matches(hash, "battery staple"); err != nil || ok {
+		t.Errorf("expected wrong password not to match, got %t, %v", ok, err)
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Error("hash with current parameters shouldn't need a rehash")
+	}
+
+	stronger := *hasher
+	stronger.Iterations = 2
+	if !stronger.NeedsRehash(hash) {
+		t.Error("hash with old parameters should need a rehash")
+	}
+}
+
+func TestArgon2id_legacyBcrypt(t *testing.T) {
+	legacy, _ := (&Bcrypt{Cost: bcrypt.MinCost}).Hash("correct horse")
+	hasher := &Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	if ok, err := hasher.Matches(legacy, "correct horse"); err != nil || !ok {
+		t.Errorf("expected legacy bcrypt hash to be verified, got %t, %v", ok, err)
+	}
+
+	if !hasher.NeedsRehash(legacy) {
+		t.Error("legacy bcrypt hash should need a rehash")
+	}
+}
+
+func TestVerify_malformed(t *testing.T) {
+	var tests = []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+		"plain text",
+	}
+
+	for _, hash := range tests {
+		if _, err := Verify(hash, "x"); err == nil {
+			t.Errorf("expected an error verifying %q", hash)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if h, err := New("argon2id", 0); err != nil || h == nil {
+		t.Errorf("expected an argon2id hasher, got %v", err)
+	}
+	if h, err := New("bcrypt", bcrypt.MinCost); err != nil || h.(*Bcrypt).Cost != bcrypt.MinCost {
+		t.Errorf("expected a bcrypt hasher, got %v", err)
+	}
+	if _, err := New("md5", 0); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
@@ -0,0 +1,159 @@
+package passwords
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// breachedList is a short list of the most common passwords found in
+// breaches, used when no other list is configured.
+//
+//go:embed breached.txt
+var breachedList string
+
+// Policy describes the rules new passwords have to follow.
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// MaxBytes is the longest password the hasher tells apart, or 0 if
+	// there is no limit; see MaxBytes.
+	MaxBytes int
+	// Breached holds known breached passwords, lower cased.
+	Breached map[string]struct{}
+}
+
+// DefaultPolicy returns a policy requiring 8 characters, which isn't one of
+// the built in breached passwords.
+func DefaultPolicy() *Policy {
+	p := &Policy{MinLength: 8}
+	_ = p.LoadBreached(strings.NewReader(breachedList))
+	return p
+}
+
+// LoadBreached adds the passwords in r, one per line, to the breached list.
+func (p *Policy) LoadBreached(r io.Reader) error {
+	if p.Breached == nil {
+		p.Breached = map[string]struct{}{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			p.Breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// LoadBreachedFile adds the passwords in a file to the breached list.
+func (p *Policy) LoadBreachedFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.LoadBreached(f)
+}
+
+// Problem is one way in which a password breaks the policy. Message is a
+// format for Args, so that it can be translated before it is formatted.
+type Problem struct {
+	Message string
+	Args    []any
+}
+
+// String returns the problem in English.
+func (p Problem) String() string {
+	return fmt.Sprintf(p.Message, p.Args...)
+}
+
+// Validate returns the ways in which password breaks the policy, if any.
+func (p *Policy) Validate(password string) []string {
+	var problems []string
+	for _, problem := range p.Problems(password) {
+		problems = append(problems, problem.String())
+	}
+	return problems
+}
+
+// Problems is Validate, with the problems left unformatted.
+func (p *Policy) Problems(password string) []Problem {
+	var problems []Problem
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		problems = append(problems, Problem{Message: "Password must be at most %d bytes long", Args: []any{p.MaxBytes}})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, Problem{Message: "Password must be at least %d characters long", Args: []any{p.MinLength}})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		problems = append(problems, Problem{Message: "Password must contain an upper case letter"})
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, Problem{Message: "Password must contain a lower case letter"})
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, Problem{Message: "Password must contain a digit"})
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, Problem{Message: "Password must contain a symbol"})
+	}
+
+	if _, ok := p.Breached[strings.ToLower(password)]; ok {
+		problems = append(problems, Problem{Message: "This password has appeared in a data breach, please choose another one"})
+	}
+
+	return problems
+}
+
+// SetClasses sets the required character classes from a comma separated
+// list of upper, lower, digit and symbol.
+func (p *Policy) SetClasses(classes string) error {
+	p.RequireUpper, p.RequireLower, p.RequireDigit, p.RequireSymbol = false, false, false, false
+
+	for _, class := range strings.Split(classes, ",") {
+		switch strings.TrimSpace(class) {
+		case "":
+		case "upper":
+			p.RequireUpper = true
+		case "lower":
+			p.RequireLower = true
+		case "digit":
+			p.RequireDigit = true
+		case "symbol":
+			p.RequireSymbol = true
+		default:
+			return fmt.Errorf("unknown character class %q", class)
+		}
+	}
+
+	return nil
+}
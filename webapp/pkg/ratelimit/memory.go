@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired windows are removed from a MemoryStore.
+const sweepInterval = time.Minute
+
+type window struct {
+	hits  int
+	reset time.Time
+}
+
+// MemoryStore is an in-memory, fixed window Store. It is only suitable for
+// a single instance of the application.
+type MemoryStore struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		windows: map[string]*window{},
+		now:     time.Now,
+	}
+}
+
+// Take records a hit for key in the current window.
+func (m *MemoryStore) Take(key string, limit int, length time.Duration) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	w, ok := m.windows[key]
+	if !ok || !now.Before(w.reset) {
+		w = &window{reset: now.Add(length)}
+		m.windows[key] = w
+	}
+	w.hits++
+
+	remaining := limit - w.hits
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return Result{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     w.reset,
+		Allowed:   w.hits <= limit,
+	}, nil
+}
+
+// sweep drops expired windows, so that the map doesn't grow forever.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+	for key, w := range m.windows {
+		if !now.Before(w.reset) {
+			delete(m.windows, key)
+		}
+	}
+	m.nextSweep = now.Add(sweepInterval)
+}
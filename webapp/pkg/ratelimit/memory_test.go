@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	now := time.Date(2022, 8, 19, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	var tests = []struct {
+		name              string
+		key               string
+		advance           time.Duration
+		expectedAllowed   bool
+		expectedRemaining int
+	}{
+		{"first hit", "a", 0, true, 1},
+		{"second hit", "a", 0, true, 0},
+		{"over the limit", "a", 0, false, 0},
+		{"other key", "b", 0, true, 1},
+		{"window reset", "a", time.Minute, true, 1},
+	}
+
+	for _, e := range tests {
+		now = now.Add(e.advance)
+
+		res, err := store.Take(e.key, 2, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", e.name, err)
+		}
+
+		if res.Allowed != e.expectedAllowed {
+			t.Errorf("%s: expected allowed to be %t, but got %t", e.name, e.expectedAllowed, res.Allowed)
+		}
+
+		if res.Remaining != e.expectedRemaining {
+			t.Errorf("%s: expected %d remaining, but got %d", e.name, e.expectedRemaining, res.Remaining)
+		}
+	}
+}
+
+func TestMemoryStore_sweep(t *testing.T) {
+	now := time.Date(2022, 8, 19, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	_, _ = store.Take("a", 1, time.Second)
+
+	now = now.Add(2 * sweepInterval)
+	_, _ = store.Take("b", 1, time.Second)
+
+	if _, ok := store.windows["a"]; ok {
+		t.Error("expected expired window to be swept, but it is still there")
+	}
+}
+
+func TestResult_RetryAfter(t *testing.T) {
+	now := time.Date(2022, 8, 19, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name     string
+		reset    time.Time
+		expected time.Duration
+	}{
+		{"in the future", now.Add(30 * time.Second), 30 * time.Second},
+		{"now", now, 0},
+		{"in the past", now.Add(-time.Second), 0},
+	}
+
+	for _, e := range tests {
+		if d := (Result{Reset: e.reset}).RetryAfter(now); d != e.expected {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expected, d)
+		}
+	}
+}
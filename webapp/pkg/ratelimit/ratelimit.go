@@ -0,0 +1,27 @@
+// Package ratelimit provides request rate limiting with pluggable backends.
+package ratelimit
+
+import "time"
+
+// Result describes the state of a rate limit after a hit has been recorded.
+type Result struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	Allowed   bool
+}
+
+// RetryAfter returns how long a client has to wait before the limit resets.
+func (r Result) RetryAfter(now time.Time) time.Duration {
+	if d := r.Reset.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Store is the interface for rate limit backends.
+type Store interface {
+	// Take records a hit for key and reports whether it is allowed, given
+	// that at most limit hits are accepted per window.
+	Take(key string, limit int, window time.Duration) (Result, error)
+}
@@ -0,0 +1,71 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+)
+
+// PurgeDeletedUsers erases the users deleted before olderThan, and with
+// them everything they own. It returns how many users were erased, and the
+// image files no user has any more, for the caller to remove. Uploads keep
+// their original name, so a file can still belong to someone else.
+func (m *PostgresDBRepo) PurgeDeletedUsers(olderThan time.Time) (int, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `select distinct ui.file_name
+		from user_images ui join users u on (u.id = ui.user_id)
+		where u.deleted_at < $1`
+
+	rows, err := tx.QueryContext(ctx, query, olderThan)
+	if err != nil {
+		return 0, nil, err
+	}
+	var files []string
+	for rows.Next() {
+		var f string
+		if err := rows.Scan(&f); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		files = append(files, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `delete from users where deleted_at < $1`, olderThan)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the images of the erased users are gone with them
+	var unused []string
+	for _, f := range files {
+		var inUse bool
+		err := tx.QueryRowContext(ctx, `select exists(select 1 from user_images where file_name = $1)`, f).Scan(&inUse)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !inUse {
+			unused = append(unused, f)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return int(n), unused, nil
+}
@@ -0,0 +1,9 @@
+package dbrepo
+
+import "time"
+
+// PurgeDeletedUsers erases the users deleted before olderThan. There is
+// always one, whose profile.png nobody else has.
+func (m *TestDBRepo) PurgeDeletedUsers(olderThan time.Time) (int, []string, error) {
+	return 1, []string{"profile.png"}, nil
+}
@@ -0,0 +1,138 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+)
+
+// InsertAPIKey stores a new API key, and returns its id.
+func (m *PostgresDBRepo) InsertAPIKey(k data.APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		k.UserID,
+		k.Name,
+		k.Prefix,
+		k.Hash,
+		strings.Join(k.Scopes, ","),
+		k.ExpiresAt,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetAPIKeyByPrefix returns the API key with prefix, whether or not it is
+// still active.
+func (m *PostgresDBRepo) GetAPIKeyByPrefix(prefix string) (*data.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		from api_keys where prefix = $1`
+
+	return scanAPIKey(m.DB.QueryRowContext(ctx, query, prefix))
+}
+
+// AllAPIKeys returns the API keys of a user, newest first, including
+// revoked and expired ones.
+func (m *PostgresDBRepo) AllAPIKeys(userID int) ([]*data.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		from api_keys where user_id = $1 order by created_at desc, id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*data.APIKey
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// TouchAPIKey records when an API key was last used.
+func (m *PostgresDBRepo) TouchAPIKey(id int, lastUsed time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update api_keys set last_used_at = $1 where id = $2`, lastUsed, id)
+
+	return err
+}
+
+// RevokeAPIKey revokes an API key of a user. If the user has no such key,
+// sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) RevokeAPIKey(id, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update api_keys set revoked_at = coalesce(revoked_at, $1)
+		where id = $2 and user_id = $3`
+
+	res, err := m.DB.ExecContext(ctx, stmt, time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanAPIKey scans one api_keys row.
+func scanAPIKey(row interface{ Scan(...any) error }) (*data.APIKey, error) {
+	var k data.APIKey
+	var scopes string
+
+	err := row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Name,
+		&k.Prefix,
+		&k.Hash,
+		&scopes,
+		&k.ExpiresAt,
+		&k.LastUsedAt,
+		&k.RevokedAt,
+		&k.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+
+	return &k, nil
+}
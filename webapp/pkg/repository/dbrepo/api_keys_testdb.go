@@ -0,0 +1,85 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"time"
+	"webapp/pkg/apikey"
+	"webapp/pkg/data"
+)
+
+// Test API keys, for user 1. TestAPIKey has every scope and
+// TestProfileAPIKey only profile:read; TestRevokedAPIKey has been revoked
+// and TestExpiredAPIKey has expired.
+const (
+	TestAPIKey        = "wak_testtest_secret"
+	TestRevokedAPIKey = "wak_revokedd_secret"
+	TestExpiredAPIKey = "wak_expiredd_secret"
+	TestProfileAPIKey = "wak_profilee_secret"
+)
+
+// InsertAPIKey stores a new API key, and returns its id.
+func (m *TestDBRepo) InsertAPIKey(k data.APIKey) (int, error) {
+	return 1, nil
+}
+
+// GetAPIKeyByPrefix returns the API key with prefix, whether or not it is
+// still active.
+func (m *TestDBRepo) GetAPIKeyByPrefix(prefix string) (*data.APIKey, error) {
+	for _, k := range testAPIKeys() {
+		if k.Prefix == prefix {
+			return k, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// AllAPIKeys returns the API keys of a user, newest first, including
+// revoked and expired ones.
+func (m *TestDBRepo) AllAPIKeys(userID int) ([]*data.APIKey, error) {
+	if userID != 1 {
+		return nil, nil
+	}
+	return testAPIKeys(), nil
+}
+
+// TouchAPIKey records when an API key was last used.
+func (m *TestDBRepo) TouchAPIKey(id int, lastUsed time.Time) error {
+	return nil
+}
+
+// RevokeAPIKey revokes an API key of a user. If the user has no such key,
+// sql.ErrNoRows is returned.
+func (m *TestDBRepo) RevokeAPIKey(id, userID int) error {
+	if userID != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func testAPIKeys() []*data.APIKey {
+	past := time.Now().Add(-time.Hour)
+	key := func(id int, plain string, scopes []string) *data.APIKey {
+		prefix, _ := apikey.Prefix(plain)
+		return &data.APIKey{
+			ID:        id,
+			UserID:    1,
+			Name:      prefix,
+			Prefix:    prefix,
+			Hash:      apikey.Hash(plain),
+			Scopes:    scopes,
+			CreatedAt: past,
+		}
+	}
+
+	revoked := key(2, TestRevokedAPIKey, data.APIScopes)
+	revoked.RevokedAt = &past
+	expired := key(3, TestExpiredAPIKey, data.APIScopes)
+	expired.ExpiresAt = &past
+
+	return []*data.APIKey{
+		key(1, TestAPIKey, data.APIScopes),
+		revoked,
+		expired,
+		key(4, TestProfileAPIKey, []string{data.ScopeProfileRead}),
+	}
+}
@@ -0,0 +1,133 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+)
+
+// InsertAuditEvent appends an event to the audit log, and returns its id.
+func (m *PostgresDBRepo) InsertAuditEvent(e data.AuditEvent) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return 0, err
+	}
+	if e.Details == nil {
+		details = []byte("{}")
+	}
+
+	createdAt := e.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	var newID int
+	stmt := `insert into audit_events (actor_id, target_user_id, ip, user_agent, event_type, details, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		nullInt(e.ActorID),
+		nullInt(e.TargetUserID),
+		e.IP,
+		e.UserAgent,
+		e.Type,
+		string(details),
+		createdAt,
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// AuditEvents returns the audit events matching a filter, newest first.
+func (m *PostgresDBRepo) AuditEvents(f data.AuditFilter) ([]*data.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Type != "" {
+		add("event_type = $%d", f.Type)
+	}
+	if f.UserID != 0 {
+		args = append(args, f.UserID)
+		where = append(where, fmt.Sprintf("(actor_id = $%d or target_user_id = $%d)", len(args), len(args)))
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("created_at < $%d", f.Until)
+	}
+
+	query := `select id, coalesce(actor_id, 0), coalesce(target_user_id, 0), coalesce(ip, ''),
+		coalesce(user_agent, ''), event_type, details, created_at
+		from audit_events`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by created_at desc, id desc"
+
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" limit $%d", len(args))
+	}
+	if f.Offset > 0 {
+		args = append(args, f.Offset)
+		query += fmt.Sprintf(" offset $%d", len(args))
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*data.AuditEvent
+
+	for rows.Next() {
+		var e data.AuditEvent
+		var details []byte
+		err := rows.Scan(
+			&e.ID,
+			&e.ActorID,
+			&e.TargetUserID,
+			&e.IP,
+			&e.UserAgent,
+			&e.Type,
+			&details,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			return nil, err
+		}
+
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
+
+// nullInt stores 0 as null, for optional foreign keys.
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
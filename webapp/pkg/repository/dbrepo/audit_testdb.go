@@ -0,0 +1,29 @@
+package dbrepo
+
+import (
+	"time"
+	"webapp/pkg/data"
+)
+
+// InsertAuditEvent appends an event to the audit log, and returns its id.
+func (m *TestDBRepo) InsertAuditEvent(e data.AuditEvent) (int, error) {
+	return 1, nil
+}
+
+// AuditEvents returns the audit events matching a filter, newest first.
+func (m *TestDBRepo) AuditEvents(f data.AuditFilter) ([]*data.AuditEvent, error) {
+	events := []*data.AuditEvent{
+		{
+			ID:           1,
+			ActorID:      1,
+			TargetUserID: 1,
+			IP:           "127.0.0.1",
+			UserAgent:    "Go-http-client/1.1",
+			Type:         data.AuditLogin,
+			Details:      map[string]any{},
+			CreatedAt:    time.Now(),
+		},
+	}
+
+	return events, nil
+}
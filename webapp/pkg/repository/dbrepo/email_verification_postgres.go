@@ -0,0 +1,32 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// VerifyEmail marks the email address of a user as verified, as long as it
+// is still their address. If it isn't, sql.ErrNoRows is returned.
+func (m *PostgresDBRepo) VerifyEmail(userID int, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set email_verified_at = coalesce(email_verified_at, $1)
+		where id = $2 and email = $3`
+
+	res, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID, email)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
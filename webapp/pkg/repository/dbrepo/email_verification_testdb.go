@@ -0,0 +1,12 @@
+package dbrepo
+
+import "database/sql"
+
+// VerifyEmail marks the email address of a user as verified, as long as it
+// is still their address. If it isn't, sql.ErrNoRows is returned.
+func (m *TestDBRepo) VerifyEmail(userID int, email string) error {
+	if email == "changed@example.com" {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"time"
+	"webapp/pkg/data"
+)
+
+// InsertUserIdentity links a user to an external identity, and returns the
+// id of the link.
+func (m *TestDBRepo) InsertUserIdentity(i data.UserIdentity) (int, error) {
+	return 1, nil
+}
+
+// GetUserIdentity returns the identity with subject at provider, or
+// sql.ErrNoRows if it isn't linked to a user. Only the subject
+// "linked-subject" is linked, to user 1.
+func (m *TestDBRepo) GetUserIdentity(provider, subject string) (*data.UserIdentity, error) {
+	if subject != "linked-subject" {
+		return nil, sql.ErrNoRows
+	}
+
+	return &data.UserIdentity{
+		ID:        1,
+		UserID:    1,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     "admin@example.com",
+		CreatedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,180 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+)
+
+// AllRoles returns every role, with its permissions.
+func (m *PostgresDBRepo) AllRoles() ([]*data.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select r.id, r.name, coalesce(r.description, ''),
+		coalesce(string_agg(p.name, ',' order by p.name), '')
+		from roles r
+		left join role_permissions rp on (rp.role_id = r.id)
+		left join permissions p on (p.id = rp.permission_id)
+		group by r.id
+		order by r.name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*data.Role
+
+	for rows.Next() {
+		var role data.Role
+		var permissions string
+		err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Description,
+			&permissions,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if permissions != "" {
+			role.Permissions = strings.Split(permissions, ",")
+		}
+		roles = append(roles, &role)
+	}
+
+	return roles, rows.Err()
+}
+
+// UserRoles returns the names of the roles a user has.
+func (m *PostgresDBRepo) UserRoles(userID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select r.name from user_roles ur
+		join roles r on (r.id = ur.role_id)
+		where ur.user_id = $1
+		order by r.name`
+
+	return m.strings(ctx, query, userID)
+}
+
+// AllUserRoles returns the names of the roles of every user who has any,
+// by user id, in one query rather than one for each user.
+func (m *PostgresDBRepo) AllUserRoles() (map[int][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ur.user_id, r.name from user_roles ur
+		join roles r on (r.id = ur.role_id)
+		order by ur.user_id, r.name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userRoles := make(map[int][]string)
+	for rows.Next() {
+		var userID int
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+		userRoles[userID] = append(userRoles[userID], role)
+	}
+
+	return userRoles, rows.Err()
+}
+
+// UserPermissions returns every permission a user has through their roles.
+func (m *PostgresDBRepo) UserPermissions(userID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select distinct p.name from user_roles ur
+		join role_permissions rp on (rp.role_id = ur.role_id)
+		join permissions p on (p.id = rp.permission_id)
+		where ur.user_id = $1
+		order by p.name`
+
+	return m.strings(ctx, query, userID)
+}
+
+// AssignRole gives a user a role. Unknown roles return sql.ErrNoRows.
+func (m *PostgresDBRepo) AssignRole(userID int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return assignRole(ctx, m.DB, userID, role)
+}
+
+// queryer is what *sql.DB and *sql.Tx have in common, for statements which
+// run either on their own or in a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// assignRole gives a user a role, through q. Unknown roles return
+// sql.ErrNoRows.
+func assignRole(ctx context.Context, q queryer, userID int, role string) error {
+	var roleID int
+	err := q.QueryRowContext(ctx, `select id from roles where name = $1`, role).Scan(&roleID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into user_roles (user_id, role_id, created_at) values ($1, $2, $3)
+		on conflict do nothing`
+
+	_, err = q.ExecContext(ctx, stmt, userID, roleID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeRole takes a role away from a user.
+func (m *PostgresDBRepo) RevokeRole(userID int, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from user_roles
+		where user_id = $1 and role_id = (select id from roles where name = $2)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, role)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// strings returns the single text column of a query.
+func (m *PostgresDBRepo) strings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+
+	return values, rows.Err()
+}
@@ -0,0 +1,65 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"webapp/pkg/data"
+)
+
+// testRoles are the roles every install starts with.
+var testRoles = []*data.Role{
+	{
+		ID:          1,
+		Name:        data.RoleAdmin,
+		Description: "Can do anything",
+		Permissions: []string{data.PermAuditRead, data.PermRolesManage, data.PermUsersDelete, data.PermUsersRead, data.PermUsersReset2FA},
+	},
+	{
+		ID:          2,
+		Name:        data.RoleSupport,
+		Description: "Can look up users and help them get back into their account",
+		Permissions: []string{data.PermAuditRead, data.PermUsersRead, data.PermUsersReset2FA},
+	},
+}
+
+// AllRoles returns every role, with its permissions.
+func (m *TestDBRepo) AllRoles() ([]*data.Role, error) {
+	return testRoles, nil
+}
+
+// UserRoles returns the names of the roles a user has. Only user 1 has a
+// role, admin.
+func (m *TestDBRepo) UserRoles(userID int) ([]string, error) {
+	if userID == 1 {
+		return []string{data.RoleAdmin}, nil
+	}
+	return nil, nil
+}
+
+// AllUserRoles returns the names of the roles of every user who has any,
+// by user id.
+func (m *TestDBRepo) AllUserRoles() (map[int][]string, error) {
+	return map[int][]string{1: {data.RoleAdmin}}, nil
+}
+
+// UserPermissions returns every permission a user has through their roles.
+func (m *TestDBRepo) UserPermissions(userID int) ([]string, error) {
+	if userID == 1 {
+		return testRoles[0].Permissions, nil
+	}
+	return nil, nil
+}
+
+// AssignRole gives a user a role. Unknown roles return sql.ErrNoRows.
+func (m *TestDBRepo) AssignRole(userID int, role string) error {
+	for _, r := range testRoles {
+		if r.Name == role {
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// RevokeRole takes a role away from a user.
+func (m *TestDBRepo) RevokeRole(userID int, role string) error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+	"webapp/pkg/data"
+)
+
+// InsertUserSession records a new logged in session, and clears out the
+// user's expired ones.
+func (m *PostgresDBRepo) InsertUserSession(s data.UserSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from user_sessions where user_id = $1 and expires_at < $2`
+	_, err := m.DB.ExecContext(ctx, stmt, s.UserID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	stmt = `insert into user_sessions (id, user_id, ip, user_agent, remember, created_at, last_seen, expires_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = m.DB.ExecContext(ctx, stmt,
+		s.ID,
+		s.UserID,
+		s.IP,
+		s.UserAgent,
+		s.Remember,
+		s.CreatedAt,
+		s.LastSeen,
+		s.ExpiresAt,
+	)
+
+	return err
+}
+
+// GetUserSession returns one session by id
+func (m *PostgresDBRepo) GetUserSession(id string) (*data.UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, ip, user_agent, remember, created_at, last_seen, expires_at
+		from user_sessions where id = $1`
+
+	var s data.UserSession
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&s.ID,
+		&s.UserID,
+		&s.IP,
+		&s.UserAgent,
+		&s.Remember,
+		&s.CreatedAt,
+		&s.LastSeen,
+		&s.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// AllUserSessions returns the unexpired sessions of a user, most recently
+// used first.
+func (m *PostgresDBRepo) AllUserSessions(userID int) ([]*data.UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, ip, user_agent, remember, created_at, last_seen, expires_at
+		from user_sessions where user_id = $1 and expires_at > $2 order by last_seen desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*data.UserSession
+
+	for rows.Next() {
+		var s data.UserSession
+		err := rows.Scan(
+			&s.ID,
+			&s.UserID,
+			&s.IP,
+			&s.UserAgent,
+			&s.Remember,
+			&s.CreatedAt,
+			&s.LastSeen,
+			&s.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchUserSession records that a session has just been used.
+func (m *PostgresDBRepo) TouchUserSession(id, ip string, lastSeen time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update user_sessions set ip = $1, last_seen = $2 where id = $3`
+	_, err := m.DB.ExecContext(ctx, stmt, ip, lastSeen, id)
+
+	return err
+}
+
+// DeleteUserSession revokes one session.
+func (m *PostgresDBRepo) DeleteUserSession(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from user_sessions where id = $1`, id)
+
+	return err
+}
+
+// DeleteUserSessions revokes every session of a user, except the one with
+// id exceptID. Pass an empty exceptID to revoke them all.
+func (m *PostgresDBRepo) DeleteUserSessions(userID int, exceptID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from user_sessions where user_id = $1 and id <> $2`
+	_, err := m.DB.ExecContext(ctx, stmt, userID, exceptID)
+
+	return err
+}
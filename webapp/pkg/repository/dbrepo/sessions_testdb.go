@@ -0,0 +1,56 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"time"
+	"webapp/pkg/data"
+)
+
+// InsertUserSession records a new logged in session.
+func (m *TestDBRepo) InsertUserSession(s data.UserSession) error {
+	return nil
+}
+
+// GetUserSession returns one session by id. The session "revoked" does not
+// exist, and the session "expired" has expired.
+func (m *TestDBRepo) GetUserSession(id string) (*data.UserSession, error) {
+	if id == "revoked" {
+		return nil, sql.ErrNoRows
+	}
+
+	s := data.UserSession{
+		ID:        id,
+		UserID:    1,
+		IP:        "127.0.0.1",
+		UserAgent: "Go-http-client/1.1",
+		CreatedAt: time.Now(),
+		LastSeen:  time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if id == "expired" {
+		s.ExpiresAt = time.Now().Add(-time.Hour)
+	}
+
+	return &s, nil
+}
+
+// AllUserSessions returns the unexpired sessions of a user.
+func (m *TestDBRepo) AllUserSessions(userID int) ([]*data.UserSession, error) {
+	s, _ := m.GetUserSession("current")
+	return []*data.UserSession{s}, nil
+}
+
+// TouchUserSession records that a session has just been used.
+func (m *TestDBRepo) TouchUserSession(id, ip string, lastSeen time.Time) error {
+	return nil
+}
+
+// DeleteUserSession revokes one session.
+func (m *TestDBRepo) DeleteUserSession(id string) error {
+	return nil
+}
+
+// DeleteUserSessions revokes every session of a user, except exceptID.
+func (m *TestDBRepo) DeleteUserSessions(userID int, exceptID string) error {
+	return nil
+}
@@ -0,0 +1,59 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"webapp/pkg/data"
+)
+
+// DeletedUsers returns the users in the trash, the most recently deleted
+// first.
+func (m *PostgresDBRepo) DeletedUsers() ([]*data.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, first_name, last_name, created_at, deleted_at
+		from users where deleted_at is not null order by deleted_at desc`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*data.User
+	for rows.Next() {
+		var u data.User
+		err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.CreatedAt, &u.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &u)
+	}
+
+	return users, rows.Err()
+}
+
+// RestoreUser takes a user out of the trash. It returns sql.ErrNoRows if
+// the user isn't in the trash, and repository.ErrDuplicateEmail if someone
+// else has their email address now.
+func (m *PostgresDBRepo) RestoreUser(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set deleted_at = null where id = $1 and deleted_at is not null`
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return duplicateEmail(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+)
+
+// deletedUsers are the users in the trash of the test database, deleted an
+// hour ago. User 4 had the email address user 2 has now.
+func deletedUsers() []*data.User {
+	deletedAt := time.Now().Add(-time.Hour)
+	return []*data.User{
+		{ID: 3, FirstName: "Deleted", LastName: "User", Email: "deleted@example.com", DeletedAt: &deletedAt},
+		{ID: 4, FirstName: "Former", LastName: "Owner", Email: "2fa@example.com", DeletedAt: &deletedAt},
+	}
+}
+
+// DeletedUsers returns the users in the trash; users 3 and 4 always are.
+func (m *TestDBRepo) DeletedUsers() ([]*data.User, error) {
+	return deletedUsers(), nil
+}
+
+// RestoreUser takes a user out of the trash; user 3 can be restored, and
+// user 4's email address is taken.
+func (m *TestDBRepo) RestoreUser(id int) error {
+	switch id {
+	case 3:
+		return nil
+	case 4:
+		return repository.ErrDuplicateEmail
+	}
+	return sql.ErrNoRows
+}
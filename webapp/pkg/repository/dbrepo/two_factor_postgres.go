@@ -0,0 +1,131 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+	"webapp/pkg/totp"
+)
+
+// EnableTOTP turns on two-factor authentication for a user, replacing any
+// recovery codes they had with hashes of the given ones.
+func (m *PostgresDBRepo) EnableTOTP(userID int, secret string, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update users set totp_secret = $1, totp_enabled = true, updated_at = $2 where id = $3`
+	if _, err := tx.ExecContext(ctx, stmt, secret, time.Now(), userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from user_recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	stmt = `insert into user_recovery_codes (user_id, code_hash, created_at) values ($1, $2, $3)`
+	for _, code := range recoveryCodes {
+		if _, err := tx.ExecContext(ctx, stmt, userID, totp.HashRecoveryCode(code), time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication for a user, and throws
+// away their secret and recovery codes.
+func (m *PostgresDBRepo) DisableTOTP(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `update users set totp_secret = null, totp_enabled = false, totp_last_step = null,
+		totp_failed_attempts = 0, updated_at = $1 where id = $2`
+	if _, err := tx.ExecContext(ctx, stmt, time.Now(), userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from user_recovery_codes where user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks one of a user's recovery codes as used. It returns
+// false if the code doesn't exist or has been used already.
+func (m *PostgresDBRepo) UseRecoveryCode(userID int, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update user_recovery_codes set used_at = $1
+		where user_id = $2 and code_hash = $3 and used_at is null`
+
+	res, err := m.DB.ExecContext(ctx, stmt, time.Now(), userID, totp.HashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// UseTOTPStep records that a user logged in with the code of a time step.
+// It returns false if they already used a code of that step, or of a later
+// one, so that a code which was seen can't be used again.
+func (m *PostgresDBRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set totp_last_step = $1
+		where id = $2 and (totp_last_step is null or totp_last_step < $1)`
+
+	res, err := m.DB.ExecContext(ctx, stmt, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// RecordTOTPFailure counts a wrong two-factor code entered for a user, and
+// returns how many there have been since ResetTOTPFailures.
+func (m *PostgresDBRepo) RecordTOTPFailure(userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set totp_failed_attempts = totp_failed_attempts + 1
+		where id = $1 returning totp_failed_attempts`
+
+	var failures int
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(&failures)
+	return failures, err
+}
+
+// ResetTOTPFailures forgets the wrong two-factor codes entered for a user.
+func (m *PostgresDBRepo) ResetTOTPFailures(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update users set totp_failed_attempts = 0 where id = $1`, userID)
+	return err
+}
@@ -0,0 +1,34 @@
+package dbrepo
+
+// EnableTOTP turns on two-factor authentication for a user.
+func (m *TestDBRepo) EnableTOTP(userID int, secret string, recoveryCodes []string) error {
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication for a user.
+func (m *TestDBRepo) DisableTOTP(userID int) error {
+	return nil
+}
+
+// UseRecoveryCode marks one of a user's recovery codes as used. The only
+// valid code is "recovery-code".
+func (m *TestDBRepo) UseRecoveryCode(userID int, code string) (bool, error) {
+	return code == "recovery-code", nil
+}
+
+// UseTOTPStep records that a user logged in with the code of a time step;
+// every step is new.
+func (m *TestDBRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	return true, nil
+}
+
+// RecordTOTPFailure counts a wrong two-factor code entered for a user; it is
+// always the first.
+func (m *TestDBRepo) RecordTOTPFailure(userID int) (int, error) {
+	return 1, nil
+}
+
+// ResetTOTPFailures forgets the wrong two-factor codes entered for a user.
+func (m *TestDBRepo) ResetTOTPFailures(userID int) error {
+	return nil
+}
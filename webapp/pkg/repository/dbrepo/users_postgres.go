@@ -3,30 +3,53 @@ package dbrepo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/passwords"
+	"webapp/pkg/repository"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jackc/pgconn"
 )
 
 const dbTimeout = time.Second * 3
 
+// duplicateEmail turns a violation of the unique index on the email
+// addresses of users into repository.ErrDuplicateEmail.
+func duplicateEmail(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_email_key" {
+		return repository.ErrDuplicateEmail
+	}
+	return err
+}
+
 type PostgresDBRepo struct {
 	DB *sql.DB
+	// Hasher hashes new passwords; argon2id is used when nil.
+	Hasher passwords.Hasher
 }
 
 func (m *PostgresDBRepo) Connection() *sql.DB {
 	return m.DB
 }
 
+func (m *PostgresDBRepo) hasher() passwords.Hasher {
+	if m.Hasher == nil {
+		return passwords.NewArgon2id()
+	}
+	return m.Hasher
+}
+
 // AllUsers returns all users as a slice of *data.User
 func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, is_admin, created_at, updated_at
-	from users order by last_name`
+	query := `select id, email, first_name, last_name, password, is_admin,
+	coalesce(totp_secret, ''), totp_enabled, email_verified_at, created_at, updated_at
+	from users where deleted_at is null order by last_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -45,6 +68,9 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 			&user.LastName,
 			&user.Password,
 			&user.IsAdmin,
+			&user.TOTPSecret,
+			&user.TOTPEnabled,
+			&user.EmailVerifiedAt,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -66,13 +92,14 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 
 	query := `
 		select 
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at, 
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin,
+			coalesce(u.totp_secret, ''), u.totp_enabled, u.email_verified_at, u.created_at, u.updated_at,
 			coalesce(ui.file_name, '')
 		from 
 			users u
 			left join user_images ui on (ui.user_id = u.id)
 		where 
-		    u.id = $1`
+		    u.id = $1 and u.deleted_at is null`
 
 	var user data.User
 	row := m.DB.QueryRowContext(ctx, query, id)
@@ -84,6 +111,9 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.IsAdmin,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.ProfilePic.FileName,
@@ -96,20 +126,22 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 	return &user, nil
 }
 
-// GetUserByEmail returns one user by email address
+// GetUserByEmail returns one user by email address, whatever its case, as
+// the users_email_key index compares them
 func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	query := `
 		select 
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at, 
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin,
+			coalesce(u.totp_secret, ''), u.totp_enabled, u.email_verified_at, u.created_at, u.updated_at,
 			coalesce(ui.file_name, '')
 		from 
 			users u
 			left join user_images ui on (ui.user_id = u.id)
 		where 
-		    u.email = $1`
+		    lower(u.email) = lower($1) and u.deleted_at is null`
 
 	var user data.User
 	row := m.DB.QueryRowContext(ctx, query, email)
@@ -121,6 +153,9 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.IsAdmin,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.ProfilePic.FileName,
@@ -138,7 +173,9 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
+	// a new email address has to be verified again
 	stmt := `update users set
+		email_verified_at = case when email = $1 then email_verified_at end,
 		email = $1,
 		first_name = $2,
 		last_name = $3,
@@ -157,25 +194,44 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 	)
 
 	if err != nil {
-		return err
+		return duplicateEmail(err)
 	}
 
 	return nil
 }
 
-// DeleteUser deletes one user from the database, by id
+// DeleteUser moves one user to the trash, by id, and logs them out. The
+// user is kept, with their images, until PurgeDeletedUsers erases them, and
+// can be brought back with RestoreUser until then.
 func (m *PostgresDBRepo) DeleteUser(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `delete from users where id = $1`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := m.DB.ExecContext(ctx, stmt, id)
+	stmt := `update users set deleted_at = $1 where id = $2 and deleted_at is null`
+	result, err := tx.ExecContext(ctx, stmt, time.Now(), id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from user_sessions where user_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // InsertUser inserts a new user into the database, and returns the ID of the newly inserted row
@@ -183,16 +239,23 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	hashedPassword, err := m.hasher().Hash(user.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	// a new admin is inserted together with their role, or not at all
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
 	var newID int
 	stmt := `insert into users (email, first_name, last_name, password, is_admin, created_at, updated_at)
 		values ($1, $2, $3, $4, $5, $6, $7) returning id`
 
-	err = m.DB.QueryRowContext(ctx, stmt,
+	err = tx.QueryRowContext(ctx, stmt,
 		user.Email,
 		user.FirstName,
 		user.LastName,
@@ -203,6 +266,18 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 	).Scan(&newID)
 
 	if err != nil {
+		return 0, duplicateEmail(err)
+	}
+
+	// is_admin is kept for compatibility, what admins can do comes from
+	// their roles
+	if user.IsAdmin == 1 {
+		if err := assignRole(ctx, tx, newID, data.RoleAdmin); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
 
@@ -214,7 +289,7 @@ func (m *PostgresDBRepo) ResetPassword(id int, password string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hashedPassword, err := m.hasher().Hash(password)
 	if err != nil {
 		return err
 	}
@@ -257,3 +332,30 @@ func (m *PostgresDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 
 	return newID, nil
 }
+
+// UserImages returns the images a user uploaded.
+func (m *PostgresDBRepo) UserImages(userID int) ([]*data.UserImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, file_name, created_at, updated_at
+		from user_images where user_id = $1 order by id`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*data.UserImage
+	for rows.Next() {
+		var i data.UserImage
+		err := rows.Scan(&i.ID, &i.UserID, &i.FileName, &i.CreatedAt, &i.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, &i)
+	}
+
+	return images, rows.Err()
+}
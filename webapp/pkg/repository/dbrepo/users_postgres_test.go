@@ -177,7 +177,12 @@ func TestPostgresDBRepoGetAllUsers(t *testing.T) {
 	}
 
 	// TODO: check if all users are sorted alphabetically --> eg when sorting by first name
-	// TODO: check to ensure that you can't insert users with the same email
+
+	// emails are unique, whatever their case
+	testUser.Email = "Jack@Smith.com"
+	if _, err := testRepo.InsertUser(testUser); err != repository.ErrDuplicateEmail {
+		t.Errorf("expected ErrDuplicateEmail inserting a user with a taken email, but got %v", err)
+	}
 }
 
 // Getting individual users --> eg by email or ID
@@ -207,6 +212,15 @@ func TestPostgresDBRepoGetUserByEmail(t *testing.T) {
 	if user.ID != 2 {
 		t.Errorf("wrong ID returned by GetUserByEmail; expected %d, but got %d", 2, user.ID)
 	}
+
+	// addresses are found whatever their case, like the unique index
+	// compares them
+	user, err = testRepo.GetUserByEmail("Jack@Smith.COM")
+	if err != nil {
+		t.Errorf("error getting user by email in another case: %s", err)
+	} else if user.ID != 2 {
+		t.Errorf("wrong ID returned by GetUserByEmail in another case; expected %d, but got %d", 2, user.ID)
+	}
 	// TODO: check for a non-existent email
 }
 
@@ -225,6 +239,11 @@ func TestPostgresDBRepoUpdateUser(t *testing.T) {
 	if user.FirstName != "Jane" || user.Email != "jane@smith.com" {
 		t.Errorf("error while updating user details. expected first name to be %s, but got %s. expected email to be %s but got %s", "Jane", user.FirstName, "janes@smith.com", user.Email)
 	}
+
+	user.Email = "admin@example.com"
+	if err := testRepo.UpdateUser(*user); err != repository.ErrDuplicateEmail {
+		t.Errorf("expected ErrDuplicateEmail taking the email of another user, but got %v", err)
+	}
 }
 
 // delete user
@@ -288,3 +307,474 @@ func TestPostgresDBRepoInsertUserImage(t *testing.T) {
 
 	//TODO: refactor this and other tests to table driven tests
 }
+
+// user sessions
+func TestPostgresDBRepoUserSessions(t *testing.T) {
+	now := time.Now()
+	sessions := []data.UserSession{
+		{ID: "first", UserID: 1, IP: "127.0.0.1", UserAgent: "test", CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "second", UserID: 1, IP: "127.0.0.1", UserAgent: "test", CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "expired", UserID: 1, IP: "127.0.0.1", UserAgent: "test", CreatedAt: now, LastSeen: now, ExpiresAt: now.Add(-time.Hour)},
+	}
+
+	for _, s := range sessions {
+		if err := testRepo.InsertUserSession(s); err != nil {
+			t.Fatalf("error inserting user session %s: %s", s.ID, err)
+		}
+	}
+
+	all, err := testRepo.AllUserSessions(1)
+	if err != nil {
+		t.Errorf("error getting user sessions: %s", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected %d unexpired sessions, but got %d", 2, len(all))
+	}
+
+	err = testRepo.TouchUserSession("first", "10.0.0.1", now.Add(time.Minute))
+	if err != nil {
+		t.Errorf("error touching user session: %s", err)
+	}
+
+	s, err := testRepo.GetUserSession("first")
+	if err != nil {
+		t.Fatalf("error getting user session: %s", err)
+	}
+	if s.IP != "10.0.0.1" {
+		t.Errorf("expected touched session ip to be %s, but got %s", "10.0.0.1", s.IP)
+	}
+
+	if err := testRepo.DeleteUserSession("second"); err != nil {
+		t.Errorf("error deleting user session: %s", err)
+	}
+	if _, err := testRepo.GetUserSession("second"); err == nil {
+		t.Error("expected an error getting a deleted session, but didn't get one")
+	}
+
+	if err := testRepo.DeleteUserSessions(1, ""); err != nil {
+		t.Errorf("error deleting all user sessions: %s", err)
+	}
+	all, _ = testRepo.AllUserSessions(1)
+	if len(all) != 0 {
+		t.Errorf("expected no sessions after deleting them all, but got %d", len(all))
+	}
+}
+
+// two-factor authentication
+func TestPostgresDBRepoTwoFactor(t *testing.T) {
+	err := testRepo.EnableTOTP(1, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", []string{"aaaaa-bbbbb", "ccccc-ddddd"})
+	if err != nil {
+		t.Fatalf("error enabling two-factor authentication: %s", err)
+	}
+
+	user, _ := testRepo.GetUser(1)
+	if !user.TOTPEnabled || user.TOTPSecret != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("expected two-factor authentication to be enabled for user %d", 1)
+	}
+
+	ok, err := testRepo.UseRecoveryCode(1, "AAAAA BBBBB")
+	if err != nil || !ok {
+		t.Errorf("expected recovery code to be accepted, got %t, %v", ok, err)
+	}
+
+	ok, _ = testRepo.UseRecoveryCode(1, "aaaaa-bbbbb")
+	if ok {
+		t.Error("recovery code was accepted twice")
+	}
+
+	if ok, err := testRepo.UseTOTPStep(1, 1000); err != nil || !ok {
+		t.Errorf("expected a new time step to be accepted, got %t, %v", ok, err)
+	}
+	for _, step := range []int64{1000, 999} {
+		if ok, _ := testRepo.UseTOTPStep(1, step); ok {
+			t.Errorf("time step %d was accepted after step 1000", step)
+		}
+	}
+
+	for i := 1; i <= 2; i++ {
+		if n, err := testRepo.RecordTOTPFailure(1); err != nil || n != i {
+			t.Errorf("expected failure %d, but got %d, %v", i, n, err)
+		}
+	}
+	_ = testRepo.ResetTOTPFailures(1)
+	if n, _ := testRepo.RecordTOTPFailure(1); n != 1 {
+		t.Errorf("expected failures to start again after a reset, but got %d", n)
+	}
+
+	if err := testRepo.DisableTOTP(1); err != nil {
+		t.Errorf("error disabling two-factor authentication: %s", err)
+	}
+
+	user, _ = testRepo.GetUser(1)
+	if user.TOTPEnabled || user.TOTPSecret != "" {
+		t.Errorf("expected two-factor authentication to be disabled for user %d", 1)
+	}
+
+	ok, _ = testRepo.UseRecoveryCode(1, "ccccc-ddddd")
+	if ok {
+		t.Error("recovery code was accepted after two-factor authentication was disabled")
+	}
+}
+
+// audit log
+func TestPostgresDBRepoAuditEvents(t *testing.T) {
+	events := []data.AuditEvent{
+		{ActorID: 1, TargetUserID: 1, IP: "127.0.0.1", Type: data.AuditLogin, Details: map[string]any{"remember": true}, CreatedAt: time.Now().Add(-48 * time.Hour)},
+		{TargetUserID: 1, IP: "127.0.0.1", Type: data.AuditLoginFailed, Details: map[string]any{"email": "admin@example.com"}},
+		{IP: "10.0.0.1", Type: data.AuditLoginFailed},
+	}
+
+	for _, e := range events {
+		id, err := testRepo.InsertAuditEvent(e)
+		if err != nil {
+			t.Fatalf("error inserting audit event: %s", err)
+		}
+		if id == 0 {
+			t.Error("expected an id for the audit event, but got 0")
+		}
+	}
+
+	all, err := testRepo.AuditEvents(data.AuditFilter{})
+	if err != nil {
+		t.Fatalf("error getting audit events: %s", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 audit events, but got %d", len(all))
+	}
+	if all[2].Type != data.AuditLogin || all[2].Details["remember"] != true {
+		t.Errorf("expected the oldest event last with its details, but got %+v", all[2])
+	}
+	if all[0].ActorID != 0 || all[0].TargetUserID != 0 {
+		t.Errorf("expected an event without users, but got %+v", all[0])
+	}
+
+	failed, _ := testRepo.AuditEvents(data.AuditFilter{Type: data.AuditLoginFailed, UserID: 1})
+	if len(failed) != 1 {
+		t.Errorf("expected 1 failed login for user 1, but got %d", len(failed))
+	}
+
+	recent, _ := testRepo.AuditEvents(data.AuditFilter{Since: time.Now().Add(-time.Hour)})
+	if len(recent) != 2 {
+		t.Errorf("expected 2 recent audit events, but got %d", len(recent))
+	}
+
+	page, _ := testRepo.AuditEvents(data.AuditFilter{Limit: 2, Offset: 2})
+	if len(page) != 1 {
+		t.Errorf("expected 1 audit event on the second page, but got %d", len(page))
+	}
+}
+
+// email verification
+func TestPostgresDBRepoVerifyEmail(t *testing.T) {
+	user, _ := testRepo.GetUser(1)
+	if user.EmailVerified() {
+		t.Fatal("expected a new user not to have verified their email address")
+	}
+
+	if err := testRepo.VerifyEmail(1, "someone@else.com"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows verifying an old address, but got %v", err)
+	}
+
+	if err := testRepo.VerifyEmail(1, user.Email); err != nil {
+		t.Fatalf("error verifying email address: %s", err)
+	}
+
+	user, _ = testRepo.GetUser(1)
+	if !user.EmailVerified() {
+		t.Error("expected the email address to be verified")
+	}
+
+	// saving the user without changing their address keeps it verified
+	_ = testRepo.UpdateUser(*user)
+	user, _ = testRepo.GetUser(1)
+	if !user.EmailVerified() {
+		t.Error("expected the email address to stay verified when it doesn't change")
+	}
+
+	oldEmail := user.Email
+	user.Email = "new@example.com"
+	_ = testRepo.UpdateUser(*user)
+	user, _ = testRepo.GetUser(1)
+	if user.EmailVerified() {
+		t.Error("expected a changed email address to need verifying again")
+	}
+
+	user.Email = oldEmail
+	_ = testRepo.UpdateUser(*user)
+}
+
+// external identities
+func TestPostgresDBRepoUserIdentities(t *testing.T) {
+	i := data.UserIdentity{UserID: 1, Provider: "https://accounts.example.com", Subject: "12345", Email: "admin@example.com"}
+
+	id, err := testRepo.InsertUserIdentity(i)
+	if err != nil {
+		t.Fatalf("error inserting user identity: %s", err)
+	}
+	if id == 0 {
+		t.Error("expected an id for the user identity, but got 0")
+	}
+
+	if _, err := testRepo.InsertUserIdentity(i); err == nil {
+		t.Error("expected an error linking the same identity twice, but didn't get one")
+	}
+
+	got, err := testRepo.GetUserIdentity("https://accounts.example.com", "12345")
+	if err != nil {
+		t.Fatalf("error getting user identity: %s", err)
+	}
+	if got.UserID != 1 {
+		t.Errorf("expected identity to be linked to user 1, but got %d", got.UserID)
+	}
+
+	if _, err := testRepo.GetUserIdentity("https://other.example.com", "12345"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an identity at another provider, but got %v", err)
+	}
+}
+
+// roles and permissions
+func TestPostgresDBRepoRoles(t *testing.T) {
+	roles, err := testRepo.AllRoles()
+	if err != nil {
+		t.Fatalf("error getting roles: %s", err)
+	}
+	if len(roles) != 2 || roles[0].Name != data.RoleAdmin || len(roles[0].Permissions) != 5 {
+		t.Errorf("unexpected roles %+v", roles)
+	}
+
+	// users inserted with is_admin get the admin role
+	userRoles, _ := testRepo.UserRoles(1)
+	if len(userRoles) != 1 || userRoles[0] != data.RoleAdmin {
+		t.Errorf("expected user 1 to have the admin role, but got %v", userRoles)
+	}
+
+	if err := testRepo.AssignRole(1, data.RoleSupport); err != nil {
+		t.Errorf("error assigning role: %s", err)
+	}
+	if err := testRepo.AssignRole(1, data.RoleSupport); err != nil {
+		t.Errorf("error assigning a role twice: %s", err)
+	}
+	if err := testRepo.AssignRole(1, "wizard"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows assigning an unknown role, but got %v", err)
+	}
+
+	userRoles, _ = testRepo.UserRoles(1)
+	if len(userRoles) != 2 {
+		t.Errorf("expected user 1 to have 2 roles, but got %v", userRoles)
+	}
+
+	allRoles, err := testRepo.AllUserRoles()
+	if err != nil {
+		t.Fatalf("error getting the roles of all users: %s", err)
+	}
+	if len(allRoles[1]) != 2 || allRoles[1][0] != data.RoleAdmin {
+		t.Errorf("expected user 1 to have 2 roles, but got %v", allRoles)
+	}
+
+	// permissions shared by both roles are only listed once
+	permissions, err := testRepo.UserPermissions(1)
+	if err != nil {
+		t.Fatalf("error getting permissions: %s", err)
+	}
+	if len(permissions) != 5 {
+		t.Errorf("expected 5 permissions, but got %v", permissions)
+	}
+
+	if err := testRepo.RevokeRole(1, data.RoleAdmin); err != nil {
+		t.Errorf("error revoking role: %s", err)
+	}
+	permissions, _ = testRepo.UserPermissions(1)
+	if len(permissions) != 3 {
+		t.Errorf("expected the 3 support permissions after revoking admin, but got %v", permissions)
+	}
+
+	_ = testRepo.AssignRole(1, data.RoleAdmin)
+	_ = testRepo.RevokeRole(1, data.RoleSupport)
+}
+
+// api keys
+func TestPostgresDBRepoAPIKeys(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	id, err := testRepo.InsertAPIKey(data.APIKey{
+		UserID:    1,
+		Name:      "backups",
+		Prefix:    "abcdefgh",
+		Hash:      "hash",
+		Scopes:    []string{data.ScopeProfileRead, data.ScopeAuditRead},
+		ExpiresAt: &expires,
+	})
+	if err != nil {
+		t.Fatalf("error inserting api key: %s", err)
+	}
+
+	key, err := testRepo.GetAPIKeyByPrefix("abcdefgh")
+	if err != nil {
+		t.Fatalf("error getting api key: %s", err)
+	}
+	if key.ID != id || len(key.Scopes) != 2 || key.LastUsedAt != nil || !key.Active(time.Now()) {
+		t.Errorf("unexpected api key %+v", key)
+	}
+
+	if _, err := testRepo.GetAPIKeyByPrefix("unknown"); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an unknown prefix, but got %v", err)
+	}
+
+	if err := testRepo.TouchAPIKey(id, time.Now()); err != nil {
+		t.Errorf("error touching api key: %s", err)
+	}
+
+	keys, err := testRepo.AllAPIKeys(1)
+	if err != nil {
+		t.Fatalf("error listing api keys: %s", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("unexpected api keys %+v", keys)
+	}
+
+	if err := testRepo.RevokeAPIKey(id, 2); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows revoking another user's key, but got %v", err)
+	}
+	if err := testRepo.RevokeAPIKey(id, 1); err != nil {
+		t.Errorf("error revoking api key: %s", err)
+	}
+
+	key, _ = testRepo.GetAPIKeyByPrefix("abcdefgh")
+	if key.RevokedAt == nil || key.Active(time.Now()) {
+		t.Error("expected revoked api key to be inactive")
+	}
+}
+
+func TestPostgresDBRepoUserImages(t *testing.T) {
+	images, err := testRepo.UserImages(1)
+	if err != nil {
+		t.Fatalf("error listing user images: %s", err)
+	}
+	if len(images) != 1 || images[0].FileName != "test.jpg" {
+		t.Errorf("unexpected user images %+v", images)
+	}
+}
+
+func TestPostgresDBRepoPurgeDeletedUsers(t *testing.T) {
+	var ids []int
+	for _, email := range []string{"gone@example.com", "shared@example.com"} {
+		id, err := testRepo.InsertUser(data.User{
+			FirstName: "Deleted",
+			LastName:  "User",
+			Email:     email,
+			Password:  "secret",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("error inserting user: %s", err)
+		}
+		ids = append(ids, id)
+	}
+	gone, shared := ids[0], ids[1]
+
+	// gone has a file of their own, shared has test.jpg like user 1
+	for _, i := range []data.UserImage{{UserID: gone, FileName: "gone.jpg"}, {UserID: shared, FileName: "test.jpg"}} {
+		if _, err := testRepo.InsertUserImage(i); err != nil {
+			t.Fatalf("error inserting user image: %s", err)
+		}
+	}
+
+	for _, id := range ids {
+		if err := testRepo.DeleteUser(id); err != nil {
+			t.Fatalf("error deleting user %d: %s", id, err)
+		}
+	}
+	if err := testRepo.DeleteUser(gone); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows deleting a deleted user again, but got %v", err)
+	}
+
+	if _, err := testRepo.GetUser(gone); err == nil {
+		t.Error("expected a deleted user not to be found by id")
+	}
+	if _, err := testRepo.GetUserByEmail("gone@example.com"); err == nil {
+		t.Error("expected a deleted user not to be found by email")
+	}
+	users, _ := testRepo.AllUsers()
+	for _, u := range users {
+		if u.ID == gone || u.ID == shared {
+			t.Error("expected deleted users not to be listed")
+		}
+	}
+
+	n, files, err := testRepo.PurgeDeletedUsers(time.Now().Add(-time.Hour))
+	if err != nil || n != 0 || len(files) != 0 {
+		t.Errorf("expected nothing deleted an hour ago to be purged, but got %d, %v, %v", n, files, err)
+	}
+
+	n, files, err = testRepo.PurgeDeletedUsers(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error purging deleted users: %s", err)
+	}
+	// user 2 was deleted by TestPostgresDBRepoDeleteUser
+	if n != 3 {
+		t.Errorf("expected 3 users to be purged, but got %d", n)
+	}
+	if len(files) != 1 || files[0] != "gone.jpg" {
+		t.Errorf("expected gone.jpg to be unused, but got %v", files)
+	}
+
+	if images, _ := testRepo.UserImages(gone); len(images) != 0 {
+		t.Errorf("expected the images of a purged user to be gone, but got %+v", images)
+	}
+}
+
+func TestPostgresDBRepoRestoreUser(t *testing.T) {
+	id, err := testRepo.InsertUser(data.User{
+		FirstName: "Restored",
+		LastName:  "User",
+		Email:     "restored@example.com",
+		Password:  "secret",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("error inserting user: %s", err)
+	}
+	if _, err := testRepo.InsertUserImage(data.UserImage{UserID: id, FileName: "restored.jpg"}); err != nil {
+		t.Fatalf("error inserting user image: %s", err)
+	}
+
+	if err := testRepo.RestoreUser(id); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows restoring a user who isn't deleted, but got %v", err)
+	}
+
+	if err := testRepo.DeleteUser(id); err != nil {
+		t.Fatalf("error deleting user: %s", err)
+	}
+
+	deleted, err := testRepo.DeletedUsers()
+	if err != nil {
+		t.Fatalf("error listing deleted users: %s", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != id || deleted[0].DeletedAt == nil {
+		t.Errorf("expected user %d in the trash, but got %+v", id, deleted)
+	}
+
+	if err := testRepo.RestoreUser(id); err != nil {
+		t.Errorf("error restoring user: %s", err)
+	}
+	if u, err := testRepo.GetUser(id); err != nil || u.ProfilePic.FileName != "restored.jpg" {
+		t.Errorf("expected the restored user with their image, but got %+v, %v", u, err)
+	}
+
+	deleted, _ = testRepo.DeletedUsers()
+	if len(deleted) != 0 {
+		t.Errorf("expected the trash to be empty, but got %+v", deleted)
+	}
+
+	// a user can't come back while someone else has their email address
+	if err := testRepo.DeleteUser(id); err != nil {
+		t.Fatalf("error deleting user: %s", err)
+	}
+	if _, err := testRepo.InsertUser(data.User{FirstName: "New", LastName: "Owner", Email: "Restored@example.com", Password: "secret"}); err != nil {
+		t.Fatalf("error inserting a user with the deleted user's email: %s", err)
+	}
+	if err := testRepo.RestoreUser(id); err != repository.ErrDuplicateEmail {
+		t.Errorf("expected ErrDuplicateEmail restoring a user whose email is taken, but got %v", err)
+	}
+}
@@ -3,8 +3,10 @@ package dbrepo
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/repository"
 )
 
 type TestDBRepo struct{}
@@ -20,8 +22,15 @@ func (m *TestDBRepo) AllUsers() ([]*data.User, error) {
 	return users, nil
 }
 
+// TestTOTPSecret is the two-factor secret of the test user with id 2.
+const TestTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
 // GetUser returns one user by id
 func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
+	if id == 2 {
+		return totpUser(), nil
+	}
+
 	var user = data.User{
 		ID: 1,
 	}
@@ -29,8 +38,9 @@ func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
 	return &user, nil
 }
 
-// GetUserByEmail returns one user by email address
+// GetUserByEmail returns one user by email address, whatever its case
 func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
+	email = strings.ToLower(email)
 	if email == "admin@example.com" {
 		user := data.User{
 			ID:        1,
@@ -44,15 +54,41 @@ func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		}
 		return &user, nil
 	}
-	return nil, errors.New("user not found")
+	if email == "2fa@example.com" {
+		return totpUser(), nil
+	}
+	if email == "broken@example.com" {
+		return nil, errors.New("connection refused")
+	}
+	return nil, sql.ErrNoRows
+}
+
+// totpUser returns a user with two-factor authentication enabled, and the
+// password "secret".
+func totpUser() *data.User {
+	return &data.User{
+		ID:          2,
+		FirstName:   "Two",
+		LastName:    "Factor",
+		Email:       "2fa@example.com",
+		Password:    "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
+		TOTPSecret:  TestTOTPSecret,
+		TOTPEnabled: true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
 }
 
 // UpdateUser updates one user in the database
 func (m *TestDBRepo) UpdateUser(u data.User) error {
+	// emails are unique whatever their case
+	if strings.EqualFold(u.Email, "admin@example.com") && u.ID != 1 {
+		return repository.ErrDuplicateEmail
+	}
 	return nil
 }
 
-// DeleteUser deletes one user from the database, by id
+// DeleteUser moves one user to the trash, by id
 func (m *TestDBRepo) DeleteUser(id int) error {
 	return nil
 }
@@ -71,3 +107,15 @@ func (m *TestDBRepo) ResetPassword(id int, password string) error {
 func (m *TestDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 	return 1, nil
 }
+
+// UserImages returns the images a user uploaded; user 2 has profile.png,
+// and shared.png, which another user uploaded too.
+func (m *TestDBRepo) UserImages(userID int) ([]*data.UserImage, error) {
+	if userID == 2 {
+		return []*data.UserImage{
+			{ID: 1, UserID: 2, FileName: "profile.png"},
+			{ID: 2, UserID: 2, FileName: "shared.png"},
+		}, nil
+	}
+	return nil, nil
+}
@@ -2,9 +2,15 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"time"
 	"webapp/pkg/data"
 )
 
+// ErrDuplicateEmail is returned when a user would get the email address of
+// another user, which the database doesn't allow.
+var ErrDuplicateEmail = errors.New("repository: a user already has this email address")
+
 type DatabaseRepo interface {
 	Connection() *sql.DB
 	AllUsers() ([]*data.User, error)
@@ -15,4 +21,36 @@ type DatabaseRepo interface {
 	InsertUser(user data.User) (int, error)
 	ResetPassword(id int, password string) error
 	InsertUserImage(i data.UserImage) (int, error)
+	UserImages(userID int) ([]*data.UserImage, error)
+	DeletedUsers() ([]*data.User, error)
+	RestoreUser(id int) error
+	PurgeDeletedUsers(olderThan time.Time) (int, []string, error)
+	InsertUserSession(s data.UserSession) error
+	GetUserSession(id string) (*data.UserSession, error)
+	AllUserSessions(userID int) ([]*data.UserSession, error)
+	TouchUserSession(id, ip string, lastSeen time.Time) error
+	DeleteUserSession(id string) error
+	DeleteUserSessions(userID int, exceptID string) error
+	EnableTOTP(userID int, secret string, recoveryCodes []string) error
+	DisableTOTP(userID int) error
+	UseRecoveryCode(userID int, code string) (bool, error)
+	UseTOTPStep(userID int, step int64) (bool, error)
+	RecordTOTPFailure(userID int) (int, error)
+	ResetTOTPFailures(userID int) error
+	VerifyEmail(userID int, email string) error
+	InsertUserIdentity(i data.UserIdentity) (int, error)
+	GetUserIdentity(provider, subject string) (*data.UserIdentity, error)
+	AllRoles() ([]*data.Role, error)
+	UserRoles(userID int) ([]string, error)
+	AllUserRoles() (map[int][]string, error)
+	UserPermissions(userID int) ([]string, error)
+	AssignRole(userID int, role string) error
+	RevokeRole(userID int, role string) error
+	InsertAPIKey(k data.APIKey) (int, error)
+	GetAPIKeyByPrefix(prefix string) (*data.APIKey, error)
+	AllAPIKeys(userID int) ([]*data.APIKey, error)
+	TouchAPIKey(id int, lastUsed time.Time) error
+	RevokeAPIKey(id, userID int) error
+	InsertAuditEvent(e data.AuditEvent) (int, error)
+	AuditEvents(f data.AuditFilter) ([]*data.AuditEvent, error)
 }
\ No newline at end of file
@@ -0,0 +1,91 @@
+// Package reqctx keeps per-request values in a context.Context. Every value
+// has a typed setter, and a getter that reports whether the value is there,
+// so that a missing value is never a panic.
+package reqctx
+
+import (
+	"context"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+)
+
+type key int
+
+const (
+	ipKey key = iota
+	requestIDKey
+	userKey
+	permissionsKey
+	apiKeyKey
+	printerKey
+)
+
+// WithIP returns a copy of ctx holding the IP address of the client.
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipKey, ip)
+}
+
+// IP returns the IP address of the client.
+func IP(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ipKey).(string)
+	return ip, ok
+}
+
+// WithRequestID returns a copy of ctx holding the id of the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the id of the request, which ties log lines to it.
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// WithUser returns a copy of ctx holding the current user.
+func WithUser(ctx context.Context, user data.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// User returns the current user, logged in through the session or
+// authenticated by an API key.
+func User(ctx context.Context) (data.User, bool) {
+	user, ok := ctx.Value(userKey).(data.User)
+	return user, ok
+}
+
+// WithPermissions returns a copy of ctx holding the permissions of the
+// current user.
+func WithPermissions(ctx context.Context, permissions []string) context.Context {
+	return context.WithValue(ctx, permissionsKey, permissions)
+}
+
+// Permissions returns the permissions of the current user.
+func Permissions(ctx context.Context) ([]string, bool) {
+	permissions, ok := ctx.Value(permissionsKey).([]string)
+	return permissions, ok
+}
+
+// WithAPIKey returns a copy of ctx holding the API key the request was
+// authenticated with.
+func WithAPIKey(ctx context.Context, k *data.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey, k)
+}
+
+// APIKey returns the API key the request was authenticated with.
+func APIKey(ctx context.Context) (*data.APIKey, bool) {
+	k, ok := ctx.Value(apiKeyKey).(*data.APIKey)
+	return k, ok && k != nil
+}
+
+// WithPrinter returns a copy of ctx holding the printer for the locale the
+// request is answered in.
+func WithPrinter(ctx context.Context, p *i18n.Printer) context.Context {
+	return context.WithValue(ctx, printerKey, p)
+}
+
+// Printer returns the printer for the locale the request is answered in.
+func Printer(ctx context.Context) (*i18n.Printer, bool) {
+	p, ok := ctx.Value(printerKey).(*i18n.Printer)
+	return p, ok && p != nil
+}
@@ -0,0 +1,69 @@
+package reqctx
+
+import (
+	"context"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+)
+
+func TestMissingValues(t *testing.T) {
+	ctx := context.Background()
+
+	if _, ok := IP(ctx); ok {
+		t.Error("expected no IP")
+	}
+	if _, ok := RequestID(ctx); ok {
+		t.Error("expected no request id")
+	}
+	if _, ok := User(ctx); ok {
+		t.Error("expected no user")
+	}
+	if _, ok := Permissions(ctx); ok {
+		t.Error("expected no permissions")
+	}
+	if _, ok := APIKey(ctx); ok {
+		t.Error("expected no API key")
+	}
+	if _, ok := Printer(ctx); ok {
+		t.Error("expected no printer")
+	}
+}
+
+func TestValues(t *testing.T) {
+	ctx := WithIP(context.Background(), "127.0.0.1")
+	ctx = WithRequestID(ctx, "abc")
+	ctx = WithUser(ctx, data.User{ID: 1})
+	ctx = WithPermissions(ctx, []string{data.PermAuditRead})
+	ctx = WithAPIKey(ctx, &data.APIKey{ID: 2})
+	bundle, err := i18n.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithPrinter(ctx, bundle.Printer("de"))
+
+	if ip, ok := IP(ctx); !ok || ip != "127.0.0.1" {
+		t.Errorf("unexpected IP %q", ip)
+	}
+	if id, ok := RequestID(ctx); !ok || id != "abc" {
+		t.Errorf("unexpected request id %q", id)
+	}
+	if user, ok := User(ctx); !ok || user.ID != 1 {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if permissions, ok := Permissions(ctx); !ok || len(permissions) != 1 {
+		t.Errorf("unexpected permissions %v", permissions)
+	}
+	if k, ok := APIKey(ctx); !ok || k.ID != 2 {
+		t.Errorf("unexpected API key %+v", k)
+	}
+	if p, ok := Printer(ctx); !ok || p.Locale() != "de" {
+		t.Errorf("unexpected printer %+v", p)
+	}
+
+	// a user without any permissions still has them loaded
+	ctx = WithPermissions(ctx, nil)
+	if _, ok := Permissions(ctx); !ok {
+		t.Error("expected empty permissions to be present")
+	}
+}
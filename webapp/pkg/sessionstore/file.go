@@ -0,0 +1,150 @@
+package sessionstore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileStore keeps sessions as files in a directory. It is meant for
+// development, where sessions should survive restarts without a database.
+type FileStore struct {
+	dir         string
+	stopCleanup chan bool
+}
+
+// NewFileStore returns a FileStore which keeps its sessions in dir, creating
+// the directory if needed. Expired sessions are removed every
+// cleanupInterval; pass 0 to disable the cleanup.
+func NewFileStore(dir string, cleanupInterval time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	f := &FileStore{dir: dir}
+	if cleanupInterval > 0 {
+		f.stopCleanup = make(chan bool)
+		go startCleanup(f.deleteExpired, cleanupInterval, f.stopCleanup)
+	}
+
+	return f, nil
+}
+
+// Find returns the data for a session token.
+func (f *FileStore) Find(token string) ([]byte, bool, error) {
+	contents, err := os.ReadFile(f.path(token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	expiry, b, ok := decodeFile(contents)
+	if !ok || time.Now().After(expiry) {
+		return nil, false, nil
+	}
+
+	return b, true, nil
+}
+
+// Commit writes the session data to disk, replacing any previous data for
+// the token.
+func (f *FileStore) Commit(token string, b []byte, expiry time.Time) error {
+	tmp, err := os.CreateTemp(f.dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(encodeFile(expiry, b)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// renaming is atomic, so readers never see a half written session
+	return os.Rename(tmp.Name(), f.path(token))
+}
+
+// Delete removes a session token and its data.
+func (f *FileStore) Delete(token string) error {
+	err := os.Remove(f.path(token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// StopCleanup terminates the background cleanup goroutine.
+func (f *FileStore) StopCleanup() {
+	if f.stopCleanup != nil {
+		f.stopCleanup <- true
+	}
+}
+
+func (f *FileStore) deleteExpired() error {
+	paths, err := filepath.Glob(filepath.Join(f.dir, "*.session"))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		contents, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		if expiry, _, ok := decodeFile(contents); !ok || time.Now().After(expiry) {
+			_ = os.Remove(p)
+		}
+	}
+
+	return nil
+}
+
+// path returns the file for a token. Tokens come from cookies, so they are
+// hashed rather than trusted as file names.
+func (f *FileStore) path(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".session")
+}
+
+// encodeFile prefixes the session data with its expiry time.
+func encodeFile(expiry time.Time, b []byte) []byte {
+	out := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint64(out, uint64(expiry.UnixNano()))
+	return append(out, b...)
+}
+
+func decodeFile(contents []byte) (time.Time, []byte, bool) {
+	if len(contents) < 8 {
+		return time.Time{}, nil, false
+	}
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(contents[:8])))
+	return expiry, contents[8:], true
+}
+
+// startCleanup calls deleteExpired every interval, until told to stop.
+func startCleanup(deleteExpired func() error, interval time.Duration, stop chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := deleteExpired(); err != nil {
+				log.Println("error removing expired sessions:", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package sessionstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Commit("token", []byte("hello"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error committing session: %s", err)
+	}
+
+	b, found, err := store.Find("token")
+	if err != nil || !found {
+		t.Fatalf("expected to find session, got found=%t err=%v", found, err)
+	}
+	if !bytes.Equal(b, []byte("hello")) {
+		t.Errorf("expected session data %q, but got %q", "hello", b)
+	}
+
+	if err := store.Delete("token"); err != nil {
+		t.Errorf("error deleting session: %s", err)
+	}
+
+	if _, found, _ := store.Find("token"); found {
+		t.Error("found session after deleting it")
+	}
+
+	if err := store.Delete("token"); err != nil {
+		t.Errorf("deleting a missing session should not be an error, got %s", err)
+	}
+}
+
+func TestFileStore_expired(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir, 0)
+
+	_ = store.Commit("old", []byte("stale"), time.Now().Add(-time.Minute))
+	_ = store.Commit("new", []byte("fresh"), time.Now().Add(time.Minute))
+
+	if _, found, _ := store.Find("old"); found {
+		t.Error("found an expired session")
+	}
+
+	if err := store.deleteExpired(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.session"))
+	if len(files) != 1 {
+		t.Errorf("expected 1 session file after cleanup, but got %d", len(files))
+	}
+}
+
+func TestFileStore_tokenIsNotAPath(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(filepath.Join(dir, "sessions"), 0)
+
+	_ = store.Commit("../escaped", []byte("x"), time.Now().Add(time.Minute))
+
+	if _, err := os.Stat(filepath.Join(dir, "escaped")); err == nil {
+		t.Error("session token was used as a file path")
+	}
+}
@@ -0,0 +1,86 @@
+// Package sessionstore provides scs session stores which persist sessions
+// across restarts of the application.
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const dbTimeout = time.Second * 3
+
+// PostgresStore keeps sessions in the sessions table of a Postgres database,
+// so that they survive restarts and can be shared between instances.
+type PostgresStore struct {
+	DB          *sql.DB
+	stopCleanup chan bool
+}
+
+// NewPostgresStore returns a PostgresStore using db. Expired sessions are
+// removed every cleanupInterval; pass 0 to disable the cleanup.
+func NewPostgresStore(db *sql.DB, cleanupInterval time.Duration) *PostgresStore {
+	p := &PostgresStore{DB: db}
+	if cleanupInterval > 0 {
+		p.stopCleanup = make(chan bool)
+		go startCleanup(p.deleteExpired, cleanupInterval, p.stopCleanup)
+	}
+
+	return p
+}
+
+// Find returns the data for a session token.
+func (p *PostgresStore) Find(token string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select data from sessions where token = $1 and current_timestamp < expiry`
+
+	var b []byte
+	err := p.DB.QueryRowContext(ctx, query, token).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit adds or replaces the data for a session token.
+func (p *PostgresStore) Commit(token string, b []byte, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into sessions (token, data, expiry) values ($1, $2, $3)
+		on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`
+
+	_, err := p.DB.ExecContext(ctx, stmt, token, b, expiry)
+	return err
+}
+
+// Delete removes a session token and its data.
+func (p *PostgresStore) Delete(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+// StopCleanup terminates the background cleanup goroutine.
+func (p *PostgresStore) StopCleanup() {
+	if p.stopCleanup != nil {
+		p.stopCleanup <- true
+	}
+}
+
+func (p *PostgresStore) deleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, `delete from sessions where expiry < current_timestamp`)
+	return err
+}
@@ -0,0 +1,147 @@
+//go:build integration
+
+// (to run the tests --> go test -v -tags=integration .)
+package sessionstore
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgconn"
+	_ "github.com/jackc/pgx/v4"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+var (
+	host     = "localhost"
+	user     = "postgres"
+	password = "postgres"
+	dbName   = "sessions_test"
+	port     = "5436"
+	dsn      = "host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC connect_timeout=5"
+)
+
+var testDB *sql.DB
+
+func TestMain(m *testing.M) {
+	// connect to docker; fail if docker not running
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("could not connect to docker; is it running ?? %s", err)
+	}
+
+	opts := dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "14.5",
+		Env: []string{
+			"POSTGRES_USER=" + user,
+			"POSTGRES_PASSWORD=" + password,
+			"POSTGRES_DB=" + dbName,
+		},
+		ExposedPorts: []string{"5432"},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			"5432": {
+				{HostIP: "0.0.0.0", HostPort: port},
+			},
+		},
+	}
+
+	resource, err := pool.RunWithOptions(&opts)
+	if err != nil {
+		_ = pool.Purge(resource)
+		log.Fatalf("could not start resource: %s", err)
+	}
+
+	// wait until postgres is ready
+	if err := pool.Retry(func() error {
+		var err error
+		testDB, err = sql.Open("pgx", fmt.Sprintf(dsn, host, port, user, password, dbName))
+		if err != nil {
+			return err
+		}
+		return testDB.Ping()
+	}); err != nil {
+		_ = pool.Purge(resource)
+		log.Fatalf("could not connect to pg instance running on docker. Error: %s", err)
+	}
+
+	tableSQL, err := os.ReadFile("./testdata/sessions.sql")
+	if err != nil {
+		_ = pool.Purge(resource)
+		log.Fatalf("error while reading sql file in testdata folder: %s", err)
+	}
+
+	if _, err := testDB.Exec(string(tableSQL)); err != nil {
+		_ = pool.Purge(resource)
+		log.Fatalf("error creating tables in pg instance running on docker: %s", err)
+	}
+
+	code := m.Run()
+
+	if err := pool.Purge(resource); err != nil {
+		log.Fatalf("could not purge the resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestPostgresStore(t *testing.T) {
+	store := NewPostgresStore(testDB, 0)
+
+	err := store.Commit("token", []byte("hello"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error committing session: %s", err)
+	}
+
+	// overwrite the data, as scs does on every request
+	err = store.Commit("token", []byte("hello again"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("error re-committing session: %s", err)
+	}
+
+	// a new store stands in for a restarted application
+	restarted := NewPostgresStore(testDB, 0)
+
+	b, found, err := restarted.Find("token")
+	if err != nil || !found {
+		t.Fatalf("expected to find session after restart, got found=%t err=%v", found, err)
+	}
+	if !bytes.Equal(b, []byte("hello again")) {
+		t.Errorf("expected session data %q, but got %q", "hello again", b)
+	}
+
+	if err := restarted.Delete("token"); err != nil {
+		t.Errorf("error deleting session: %s", err)
+	}
+
+	if _, found, _ := restarted.Find("token"); found {
+		t.Error("found session after deleting it")
+	}
+}
+
+func TestPostgresStore_deleteExpired(t *testing.T) {
+	store := NewPostgresStore(testDB, 0)
+
+	_ = store.Commit("expired", []byte("stale"), time.Now().Add(-time.Minute))
+
+	if _, found, _ := store.Find("expired"); found {
+		t.Error("found an expired session")
+	}
+
+	if err := store.deleteExpired(); err != nil {
+		t.Fatalf("error deleting expired sessions: %s", err)
+	}
+
+	var count int
+	_ = testDB.QueryRow(`select count(*) from sessions where token = 'expired'`).Scan(&count)
+	if count != 0 {
+		t.Errorf("expected expired session to be removed, but it is still there")
+	}
+}
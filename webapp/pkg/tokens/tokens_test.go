@@ -0,0 +1,47 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	s := NewSigner([]byte("a secret key that is long enough"))
+	now := time.Now()
+
+	token := s.Sign("verify-email", 7, "odd|name@example.com", now.Add(time.Hour))
+
+	userID, email, err := s.Verify(token, "verify-email", now)
+	if err != nil {
+		t.Fatalf("expected a valid token, but got %s", err)
+	}
+	if userID != 7 || email != "odd|name@example.com" {
+		t.Errorf("expected user 7 and odd|name@example.com, but got %d and %s", userID, email)
+	}
+
+	payload, mac, _ := strings.Cut(token, ".")
+
+	var tests = []struct {
+		name     string
+		token    string
+		purpose  string
+		now      time.Time
+		expected error
+	}{
+		{"expired", token, "verify-email", now.Add(2 * time.Hour), ErrExpired},
+		{"other purpose", token, "reset-password", now, ErrInvalid},
+		{"tampered payload", encoding.EncodeToString([]byte("verify-email|1|9999999999|x@example.com")) + "." + mac, "verify-email", now, ErrInvalid},
+		{"tampered signature", payload + "." + encoding.EncodeToString([]byte("nope")), "verify-email", now, ErrInvalid},
+		{"other key", NewSigner([]byte("another key")).Sign("verify-email", 7, "x@example.com", now.Add(time.Hour)), "verify-email", now, ErrInvalid},
+		{"no signature", payload, "verify-email", now, ErrInvalid},
+		{"garbage", "!!!.???", "verify-email", now, ErrInvalid},
+	}
+
+	for _, e := range tests {
+		_, _, err := s.Verify(e.token, e.purpose, e.now)
+		if err != e.expected {
+			t.Errorf("%s: expected %v, but got %v", e.name, e.expected, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package totp implements time-based one-time passwords (RFC 6238), as used
+// by authenticator apps, along with recovery codes for when the app is lost.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is how long each code is valid for.
+	Period = 30 * time.Second
+	// Digits is the length of each code.
+	Digits = 6
+	// Skew is the number of periods either side of now that are accepted, to
+	// allow for clock drift and slow typists.
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret, base32 encoded as
+// authenticator apps expect.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Code returns the code for secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %w", err)
+	}
+
+	return hotp(key, uint64(step(t))), nil
+}
+
+// Validate reports whether code is valid for secret at time t.
+func Validate(secret, code string, t time.Time) bool {
+	_, ok := Match(secret, code, t)
+	return ok
+}
+
+// Match reports whether code is valid for secret at time t, and returns the
+// time step it belongs to. A code is valid for Skew steps either side of its
+// own, so steps are what has to be remembered to stop a code being used
+// twice.
+func Match(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	for i := -Skew; i <= Skew; i++ {
+		at := t.Add(time.Duration(i) * Period)
+		expected, err := Code(secret, at)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step(at), true
+		}
+	}
+
+	return 0, false
+}
+
+// step returns the number of the time step t is in.
+func step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// URL returns the otpauth:// url which authenticator apps scan to enrol.
+func URL(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+	v.Set("digits", fmt.Sprint(Digits))
+
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// hotp implements the HMAC-based one-time password algorithm (RFC 4226).
+func hotp(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
+
+// GenerateRecoveryCodes returns n single use recovery codes.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = c[:5] + "-" + c[5:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the hash under which a recovery code is stored.
+// Recovery codes are random, so a fast hash is enough; dashes, spaces and
+// case are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code))
+
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
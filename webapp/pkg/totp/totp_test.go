@@ -0,0 +1,119 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the sha1 key from the test vectors in RFC 6238, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	var tests = []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, e := range tests {
+		code, err := Code(rfcSecret, time.Unix(e.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != e.expected {
+			t.Errorf("at %d: expected code %s, but got %s", e.unix, e.expected, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	var tests = []struct {
+		name     string
+		code     string
+		at       time.Time
+		expected bool
+	}{
+		{"current code", "005924", now, true},
+		{"code from previous period", "005924", now.Add(Period), true},
+		{"code from too long ago", "005924", now.Add(3 * Period), false},
+		{"wrong code", "123456", now, false},
+		{"short code", "59", now, false},
+		{"code with spaces", "005 924", now, true},
+	}
+
+	for _, e := range tests {
+		if got := Validate(rfcSecret, e.code, e.at); got != e.expected {
+			t.Errorf("%s: expected %t, but got %t", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	step, ok := Match(rfcSecret, "005924", now)
+	if !ok || step != 1234567890/30 {
+		t.Errorf("expected the current step, but got %d, %t", step, ok)
+	}
+
+	// a code from the previous period belongs to its own step
+	step, ok = Match(rfcSecret, "005924", now.Add(Period))
+	if !ok || step != 1234567890/30 {
+		t.Errorf("expected the step of the code, but got %d, %t", step, ok)
+	}
+
+	if _, ok := Match(rfcSecret, "123456", now); ok {
+		t.Error("expected a wrong code not to match")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Errorf("generated secret can't be used: %s", err)
+	}
+	if !Validate(secret, code, time.Now()) {
+		t.Error("code for generated secret doesn't validate")
+	}
+}
+
+func TestURL(t *testing.T) {
+	u := URL("webapp", "admin@example.com", rfcSecret)
+
+	if !strings.HasPrefix(u, "otpauth://totp/webapp:admin@example.com?") {
+		t.Errorf("unexpected url %s", u)
+	}
+	if !strings.Contains(u, "secret="+rfcSecret) {
+		t.Errorf("secret missing from url %s", u)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, but got %d", len(codes))
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))) {
+		t.Error("hash should ignore case, dashes and spaces")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("different codes have the same hash")
+	}
+}
@@ -0,0 +1,460 @@
+// Package validate binds submitted forms into structs, and checks them
+// against the rules in the validate tags of their fields, eg
+//
+//	type signup struct {
+//		Email    string `form:"email" validate:"required,email"`
+//		Password string `form:"password" validate:"required,min=8"`
+//		Confirm  string `form:"confirm" validate:"required,eqfield=Password"`
+//	}
+//
+// The form tag names the form field, which is the name of the struct field
+// by default; "-" skips a field. A message tag replaces the message of
+// every rule of its field.
+//
+// Rules are separated by commas:
+//
+//	required        the field is filled in
+//	email           an email address, without a name
+//	min=N, max=N    the length of a string, in characters; the value of a
+//	                number; the number of values of a slice
+//	oneof=a b c     one of the space separated values
+//	eqfield=Field   equal to another struct field, eg to confirm a password
+//	nefield=Field   different from another struct field
+//	maxsize=N       the size of each file, with an optional KB or MB suffix
+//	types=a/b c/d   the content type of each file, sniffed from its content
+//	regexp=pattern  matches pattern; it takes the rest of the tag, commas
+//	                included, so it has to be the last rule
+//
+// Apart from required, rules only check fields which are filled in, so an
+// optional field can be left empty.
+package validate
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Problem is a field breaking one of its rules. Message is a format for
+// Args, so that it can be translated before it is formatted.
+type Problem struct {
+	Field   string
+	Message string
+	Args    []any
+}
+
+// String returns the problem in English.
+func (p Problem) String() string {
+	return fmt.Sprintf(p.Message, p.Args...)
+}
+
+var fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+
+// field is a struct field being bound.
+type field struct {
+	name    string
+	value   reflect.Value
+	rules   []rule
+	message string
+	filled  bool
+	files   []*multipart.FileHeader
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+// Bind copies values and files into the struct dst points to, and checks
+// its fields against their rules. What the user got wrong is returned as
+// problems; the error is for a dst which can't be bound, which is a bug.
+func Bind(dst any, values url.Values, files map[string][]*multipart.FileHeader) ([]Problem, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validate: %T is not a pointer to a struct", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	var problems []Problem
+	var fields []*field
+
+	// all fields are bound before any is checked, so that eqfield can
+	// compare with a field further down
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("form")
+		if !sf.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		rules, err := parseRules(sf.Tag.Get("validate"))
+		if err != nil {
+			return nil, fmt.Errorf("validate: field %s: %w", sf.Name, err)
+		}
+
+		f := &field{
+			name:    name,
+			value:   v.Field(i),
+			rules:   rules,
+			message: sf.Tag.Get("message"),
+			files:   files[name],
+		}
+
+		problem, err := f.bind(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("validate: field %s: %w", sf.Name, err)
+		}
+		if problem != nil {
+			problems = append(problems, *problem)
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	for _, f := range fields {
+		for _, r := range f.rules {
+			problem, err := f.check(r, v)
+			if err != nil {
+				return nil, fmt.Errorf("validate: field %s: %w", f.name, err)
+			}
+			if problem != nil {
+				problems = append(problems, *problem)
+				// one problem per field is enough to fix it
+				break
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+func parseRules(tag string) ([]rule, error) {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regexp=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "required", "email":
+		case "min", "max", "oneof", "eqfield", "nefield", "maxsize", "types", "regexp":
+			if param == "" {
+				return nil, fmt.Errorf("rule %s needs a parameter", name)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+
+		rules = append(rules, rule{name: name, param: param})
+	}
+	return rules, nil
+}
+
+// problem returns a problem of the field, or the field's own message if it
+// has one.
+func (f *field) problem(message string, args ...any) *Problem {
+	if f.message != "" {
+		return &Problem{Field: f.name, Message: f.message}
+	}
+	return &Problem{Field: f.name, Message: message, Args: args}
+}
+
+// bind sets the value of the field from raw, or from its files.
+func (f *field) bind(raw []string) (*Problem, error) {
+	switch f.value.Type() {
+	case fileHeaderType:
+		f.filled = len(f.files) > 0
+		if f.filled {
+			f.value.Set(reflect.ValueOf(f.files[0]))
+		}
+		return nil, nil
+	case reflect.SliceOf(fileHeaderType):
+		f.filled = len(f.files) > 0
+		f.value.Set(reflect.ValueOf(f.files))
+		return nil, nil
+	}
+
+	for _, s := range raw {
+		if strings.TrimSpace(s) != "" {
+			f.filled = true
+			break
+		}
+	}
+	if !f.filled {
+		return nil, nil
+	}
+
+	s := strings.TrimSpace(raw[0])
+	switch f.value.Kind() {
+	case reflect.String:
+		// strings are kept as they were sent, spaces in passwords count
+		f.value.SetString(raw[0])
+	case reflect.Slice:
+		if f.value.Type().Elem().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported type %s", f.value.Type())
+		}
+		f.value.Set(reflect.ValueOf(raw))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if s == "on" {
+			b, err = true, nil
+		}
+		if err != nil {
+			return f.problem("Choose yes or no"), nil
+		}
+		f.value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.value.Type().Bits())
+		if err != nil {
+			return f.problem("Enter a whole number"), nil
+		}
+		f.value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.value.Type().Bits())
+		if err != nil {
+			return f.problem("Enter a whole number"), nil
+		}
+		f.value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.value.Type().Bits())
+		if err != nil {
+			return f.problem("Enter a number"), nil
+		}
+		f.value.SetFloat(n)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+
+	return nil, nil
+}
+
+// check checks the field against r; the struct is there for cross field
+// rules.
+func (f *field) check(r rule, s reflect.Value) (*Problem, error) {
+	if r.name == "required" {
+		if !f.filled {
+			return f.problem("This field cannot be blank"), nil
+		}
+		return nil, nil
+	}
+	if !f.filled {
+		return nil, nil
+	}
+
+	v := f.value
+	switch r.name {
+	case "email":
+		if v.Kind() != reflect.String {
+			return nil, fmt.Errorf("email needs a string, not %s", v.Type())
+		}
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Name != "" || addr.Address != v.String() {
+			return f.problem("Enter a valid email address"), nil
+		}
+
+	case "min", "max":
+		return f.checkRange(r)
+
+	case "oneof":
+		allowed := strings.Fields(r.param)
+		for _, s := range f.strings() {
+			if !contains(allowed, s) {
+				return f.problem("Choose one of: %s", strings.Join(allowed, ", ")), nil
+			}
+		}
+
+	case "regexp":
+		re, err := compile(r.param)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range f.strings() {
+			if !re.MatchString(s) {
+				return f.problem("This isn't in the right format"), nil
+			}
+		}
+
+	case "eqfield", "nefield":
+		other := s.FieldByName(r.param)
+		if !other.IsValid() {
+			return nil, fmt.Errorf("%s: no field %s", r.name, r.param)
+		}
+		equal := reflect.DeepEqual(v.Interface(), other.Interface())
+		if r.name == "eqfield" && !equal {
+			return f.problem("This doesn't match"), nil
+		}
+		if r.name == "nefield" && equal {
+			return f.problem("This has to be different"), nil
+		}
+
+	case "maxsize":
+		max, err := parseSize(r.param)
+		if err != nil {
+			return nil, err
+		}
+		for _, fh := range f.files {
+			if fh.Size > max {
+				return f.problem("Files must be at most %s", r.param), nil
+			}
+		}
+
+	case "types":
+		allowed := strings.Fields(r.param)
+		for _, fh := range f.files {
+			contentType, err := sniff(fh)
+			if err != nil {
+				return nil, err
+			}
+			if !contains(allowed, contentType) {
+				return f.problem("Files must be one of these types: %s", strings.Join(allowed, ", ")), nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// checkRange checks min and max, which measure strings, numbers and
+// slices differently.
+func (f *field) checkRange(r rule) (*Problem, error) {
+	v := f.value
+	min := r.name == "min"
+
+	switch v.Kind() {
+	case reflect.String, reflect.Slice:
+		limit, err := strconv.Atoi(r.param)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.name, err)
+		}
+
+		n := v.Len()
+		if v.Kind() == reflect.String {
+			n = utf8.RuneCountInString(v.String())
+		}
+		switch {
+		case min && n < limit && v.Kind() == reflect.String:
+			return f.problem("Must be at least %d characters long", limit), nil
+		case !min && n > limit && v.Kind() == reflect.String:
+			return f.problem("Must be at most %d characters long", limit), nil
+		case min && n < limit:
+			return f.problem("Choose at least %d", limit), nil
+		case !min && n > limit:
+			return f.problem("Choose at most %d", limit), nil
+		}
+
+	default:
+		limit, err := strconv.ParseFloat(r.param, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.name, err)
+		}
+
+		var n float64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = v.Float()
+		default:
+			return nil, fmt.Errorf("%s doesn't work on %s", r.name, v.Type())
+		}
+		if min && n < limit {
+			return f.problem("Must be at least %s", r.param), nil
+		}
+		if !min && n > limit {
+			return f.problem("Must be at most %s", r.param), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// strings returns the value of the field as strings, one for each value of
+// a slice.
+func (f *field) strings() []string {
+	v := f.value
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String {
+		return v.Interface().([]string)
+	}
+	return []string{fmt.Sprint(v.Interface())}
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// regexps caches compiled patterns, as the same forms are bound over and
+// over.
+var regexps sync.Map
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(pattern, re)
+	return re, nil
+}
+
+// parseSize parses a size in bytes, with an optional KB or MB suffix.
+func parseSize(s string) (int64, error) {
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "MB"):
+		unit, s = 1024*1024, strings.TrimSuffix(s, "MB")
+	case strings.HasSuffix(s, "KB"):
+		unit, s = 1024, strings.TrimSuffix(s, "KB")
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("maxsize: %w", err)
+	}
+	return n * unit, nil
+}
+
+// sniff returns the content type of an uploaded file, from its first
+// bytes, as what the client claims can't be trusted.
+func sniff(fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	contentType, _, _ := strings.Cut(http.DetectContentType(buf[:n]), ";")
+	return contentType, nil
+}
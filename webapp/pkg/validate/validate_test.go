@@ -0,0 +1,281 @@
+package validate
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type signup struct {
+	Email    string   `form:"email" validate:"required,email"`
+	Password string   `form:"password" validate:"required,min=8,max=72"`
+	Confirm  string   `form:"confirm" validate:"required,eqfield=Password"`
+	Age      int      `form:"age" validate:"min=18,max=130"`
+	Score    float64  `form:"score" validate:"max=1.5"`
+	Plan     string   `form:"plan" validate:"oneof=free pro"`
+	Tags     []string `form:"tags" validate:"max=2,oneof=a b c"`
+	Username string   `form:"username" validate:"regexp=^[a-z]{2,5}$"`
+	Terms    bool     `form:"terms" validate:"required"`
+	Nickname string
+	Ignored  string `form:"-"`
+	ignored  string
+}
+
+func TestBind(t *testing.T) {
+	valid := url.Values{
+		"email":    {"jack@example.com"},
+		"password": {"correct horse"},
+		"confirm":  {"correct horse"},
+		"age":      {"42"},
+		"score":    {"1.25"},
+		"plan":     {"pro"},
+		"tags":     {"a", "c"},
+		"username": {"jack"},
+		"terms":    {"on"},
+		"Nickname": {"jj"},
+		"Ignored":  {"x"},
+		"ignored":  {"x"},
+	}
+
+	var s signup
+	problems, err := Bind(&s, valid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems but got %v", problems)
+	}
+
+	expected := signup{
+		Email:    "jack@example.com",
+		Password: "correct horse",
+		Confirm:  "correct horse",
+		Age:      42,
+		Score:    1.25,
+		Plan:     "pro",
+		Tags:     []string{"a", "c"},
+		Username: "jack",
+		Terms:    true,
+		Nickname: "jj",
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected %+v but got %+v", expected, s)
+	}
+
+	var tests = []struct {
+		name            string
+		field           string
+		value           []string
+		expectedMessage string
+	}{
+		{"missing email", "email", nil, "This field cannot be blank"},
+		{"blank email", "email", []string{"  "}, "This field cannot be blank"},
+		{"bad email", "email", []string{"jack"}, "Enter a valid email address"},
+		{"email with a name", "email", []string{"Jack <jack@example.com>"}, "Enter a valid email address"},
+		{"short password", "password", []string{"secret"}, "Must be at least 8 characters long"},
+		{"confirm doesn't match", "confirm", []string{"correct horses"}, "This doesn't match"},
+		{"not a number", "age", []string{"old"}, "Enter a whole number"},
+		{"too young", "age", []string{"17"}, "Must be at least 18"},
+		{"too old", "age", []string{"131"}, "Must be at most 130"},
+		{"not a float", "score", []string{"high"}, "Enter a number"},
+		{"score too high", "score", []string{"1.6"}, "Must be at most 1.5"},
+		{"unknown plan", "plan", []string{"gold"}, "Choose one of: free, pro"},
+		{"unknown tag", "tags", []string{"a", "d"}, "Choose one of: a, b, c"},
+		{"too many tags", "tags", []string{"a", "b", "c"}, "Choose at most 2"},
+		{"bad username", "username", []string{"Jack"}, "This isn't in the right format"},
+		{"terms not accepted", "terms", nil, "This field cannot be blank"},
+		{"terms not a bool", "terms", []string{"maybe"}, "Choose yes or no"},
+	}
+
+	for _, e := range tests {
+		values := url.Values{}
+		for k, v := range valid {
+			values[k] = v
+		}
+		values[e.field] = e.value
+
+		problems, err := Bind(&signup{}, values, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+			continue
+		}
+		// a field can break the rules of another, like confirm
+		var messages []string
+		for _, p := range problems {
+			if p.Field == e.field {
+				messages = append(messages, p.String())
+			}
+		}
+		if len(messages) != 1 || messages[0] != e.expectedMessage {
+			t.Errorf("%s: expected %q but got %v", e.name, e.expectedMessage, problems)
+		}
+	}
+}
+
+func TestBind_optional(t *testing.T) {
+	var s struct {
+		Age      int    `form:"age" validate:"min=18"`
+		Website  string `form:"website" validate:"regexp=^https://"`
+		Nickname string `form:"nickname" validate:"min=2"`
+	}
+
+	problems, err := Bind(&s, url.Values{"nickname": {""}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected empty optional fields to pass, but got %v", problems)
+	}
+}
+
+func TestBind_message(t *testing.T) {
+	var s struct {
+		Name    string `form:"name" validate:"required,min=3" message:"Give it a name"`
+		Expires int    `form:"expires" validate:"required" message:"Choose when it expires"`
+	}
+
+	problems, err := Bind(&s, url.Values{"name": {"ab"}, "expires": {"soon"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Problem{
+		{Field: "expires", Message: "Choose when it expires"},
+		{Field: "name", Message: "Give it a name"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("expected %v but got %v", expected, problems)
+	}
+}
+
+func TestBind_nefield(t *testing.T) {
+	var s struct {
+		Current string `form:"current" validate:"required"`
+		New     string `form:"new" validate:"required,nefield=Current"`
+	}
+
+	problems, err := Bind(&s, url.Values{"current": {"secret"}, "new": {"secret"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].String() != "This has to be different" {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
+
+// uploads returns the files of a multipart form, with one file for each
+// name in files.
+func uploads(t *testing.T, files map[string][]byte) map[string][]*multipart.FileHeader {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, err := mw.CreateFormFile(name, name+".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(content)
+	}
+	_ = mw.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return req.MultipartForm.File
+}
+
+func TestBind_files(t *testing.T) {
+	var img bytes.Buffer
+	_ = png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	type upload struct {
+		Image       *multipart.FileHeader   `form:"image" validate:"required,maxsize=1KB,types=image/png image/jpeg"`
+		Attachments []*multipart.FileHeader `form:"attachments" validate:"max=1"`
+	}
+
+	var tests = []struct {
+		name            string
+		files           map[string][]byte
+		expectedMessage string
+	}{
+		{"png", map[string][]byte{"image": img.Bytes()}, ""},
+		{"missing", map[string][]byte{}, "This field cannot be blank"},
+		{"too big", map[string][]byte{"image": append(img.Bytes(), make([]byte, 1024)...)}, "Files must be at most 1KB"},
+		{"not an image", map[string][]byte{"image": []byte("<html><body>hi</body></html>")}, "Files must be one of these types: image/png, image/jpeg"},
+	}
+
+	for _, e := range tests {
+		var u upload
+		problems, err := Bind(&u, nil, uploads(t, e.files))
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+			continue
+		}
+
+		if e.expectedMessage == "" {
+			if len(problems) != 0 {
+				t.Errorf("%s: expected no problems but got %v", e.name, problems)
+			}
+			if u.Image == nil {
+				t.Errorf("%s: expected the image to be bound", e.name)
+			}
+			continue
+		}
+
+		if len(problems) != 1 || problems[0].String() != e.expectedMessage {
+			t.Errorf("%s: expected %q but got %v", e.name, e.expectedMessage, problems)
+		}
+	}
+}
+
+func TestBind_errors(t *testing.T) {
+	var tests = []struct {
+		name string
+		dst  any
+	}{
+		{"not a pointer", struct{}{}},
+		{"not a struct", new(string)},
+		{"unknown rule", &struct {
+			A string `validate:"shiny"`
+		}{}},
+		{"missing parameter", &struct {
+			A string `validate:"min"`
+		}{}},
+		{"unknown field", &struct {
+			A string `validate:"eqfield=B"`
+		}{}},
+		{"bad regexp", &struct {
+			A string `validate:"regexp=("`
+		}{}},
+		{"email on a number", &struct {
+			A int `validate:"email"`
+		}{}},
+		{"unsupported type", &struct {
+			A map[string]string
+		}{}},
+	}
+
+	for _, e := range tests {
+		if _, err := Bind(e.dst, url.Values{"A": {"1"}}, nil); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestParseRules_regexpWithCommas(t *testing.T) {
+	rules, err := parseRules("required,regexp=^[a-z,]{1,3}$")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []rule{{name: "required"}, {name: "regexp", param: "^[a-z,]{1,3}$"}}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected %v but got %v", expected, rules)
+	}
+}
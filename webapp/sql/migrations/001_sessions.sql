@@ -0,0 +1,12 @@
+-- Sessions for the postgres session store (-session-store=postgres).
+
+CREATE TABLE public.sessions (
+    token text NOT NULL,
+    data bytea NOT NULL,
+    expiry timestamp with time zone NOT NULL
+);
+
+ALTER TABLE ONLY public.sessions
+    ADD CONSTRAINT sessions_pkey PRIMARY KEY (token);
+
+CREATE INDEX sessions_expiry_idx ON public.sessions USING btree (expiry);
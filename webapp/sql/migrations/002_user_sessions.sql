@@ -0,0 +1,18 @@
+-- Logged in sessions, listed on /user/sessions so that users can revoke them.
+
+CREATE TABLE public.user_sessions (
+    id character varying(64) NOT NULL,
+    user_id integer NOT NULL,
+    ip character varying(255),
+    user_agent text,
+    remember boolean DEFAULT false NOT NULL,
+    created_at timestamp without time zone,
+    last_seen timestamp without time zone,
+    expires_at timestamp without time zone
+);
+
+ALTER TABLE ONLY public.user_sessions
+    ADD CONSTRAINT user_sessions_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.user_sessions
+    ADD CONSTRAINT user_sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,27 @@
+-- Optional TOTP two-factor authentication, with single use recovery codes.
+
+ALTER TABLE public.users ADD COLUMN totp_secret character varying(64);
+ALTER TABLE public.users ADD COLUMN totp_enabled boolean DEFAULT false NOT NULL;
+
+CREATE TABLE public.user_recovery_codes (
+    id integer NOT NULL,
+    user_id integer NOT NULL,
+    code_hash character varying(64) NOT NULL,
+    used_at timestamp without time zone,
+    created_at timestamp without time zone
+);
+
+ALTER TABLE public.user_recovery_codes ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.user_recovery_codes_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+ALTER TABLE ONLY public.user_recovery_codes
+    ADD CONSTRAINT user_recovery_codes_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.user_recovery_codes
+    ADD CONSTRAINT user_recovery_codes_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+-- argon2id hashes in PHC string format are longer than bcrypt's 60 characters.
+
+ALTER TABLE public.users ALTER COLUMN password TYPE character varying(255);
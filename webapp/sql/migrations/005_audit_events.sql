@@ -0,0 +1,34 @@
+-- Append only log of security relevant events.
+
+CREATE TABLE public.audit_events (
+    id integer NOT NULL,
+    actor_id integer,
+    target_user_id integer,
+    ip character varying(255),
+    user_agent text,
+    event_type character varying(64) NOT NULL,
+    details jsonb DEFAULT '{}'::jsonb NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.audit_events ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.audit_events_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+ALTER TABLE ONLY public.audit_events
+    ADD CONSTRAINT audit_events_pkey PRIMARY KEY (id);
+
+CREATE INDEX audit_events_created_at_idx ON public.audit_events USING btree (created_at);
+
+CREATE INDEX audit_events_event_type_idx ON public.audit_events USING btree (event_type);
+
+ALTER TABLE ONLY public.audit_events
+    ADD CONSTRAINT audit_events_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+ALTER TABLE ONLY public.audit_events
+    ADD CONSTRAINT audit_events_target_user_id_fkey FOREIGN KEY (target_user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL;
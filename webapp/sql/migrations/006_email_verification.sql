@@ -0,0 +1,4 @@
+-- When each user proved they own their email address; null until they do,
+-- and again whenever the address changes.
+
+ALTER TABLE public.users ADD COLUMN email_verified_at timestamp without time zone;
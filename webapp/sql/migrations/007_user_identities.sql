@@ -0,0 +1,28 @@
+-- Accounts at external OpenID Connect providers that users can log in with.
+
+CREATE TABLE public.user_identities (
+    id integer NOT NULL,
+    user_id integer NOT NULL,
+    provider character varying(255) NOT NULL,
+    subject character varying(255) NOT NULL,
+    email character varying(255),
+    created_at timestamp without time zone
+);
+
+ALTER TABLE public.user_identities ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.user_identities_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+ALTER TABLE ONLY public.user_identities
+    ADD CONSTRAINT user_identities_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.user_identities
+    ADD CONSTRAINT user_identities_provider_subject_key UNIQUE (provider, subject);
+
+ALTER TABLE ONLY public.user_identities
+    ADD CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+-- When each user was deleted. Deleted users are kept for a grace period, so
+-- that a mistake can be undone, and erased after it; null for users who
+-- haven't been deleted.
+
+ALTER TABLE public.users ADD COLUMN deleted_at timestamp without time zone;
@@ -0,0 +1,4 @@
+-- Only one user who hasn't been deleted can have an email address, whatever
+-- its case. Deleted users keep theirs, in case they are restored.
+
+CREATE UNIQUE INDEX users_email_key ON public.users USING btree (lower((email)::text)) WHERE (deleted_at IS NULL);
@@ -0,0 +1,6 @@
+-- The time step of the last two-factor code each user logged in with, so
+-- that a code can't be used twice, and the wrong codes entered since the
+-- last login, so that codes can't be guessed.
+
+ALTER TABLE public.users ADD COLUMN totp_last_step bigint;
+ALTER TABLE public.users ADD COLUMN totp_failed_attempts integer DEFAULT 0 NOT NULL;
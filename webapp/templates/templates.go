@@ -0,0 +1,10 @@
+// Package templates embeds the HTML templates, so that the binary doesn't
+// depend on the directory it is started from.
+package templates
+
+import "embed"
+
+// FS holds the page templates, the base layout and the partials.
+//
+//go:embed *.gohtml partials/*.gohtml
+var FS embed.FS